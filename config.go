@@ -0,0 +1,591 @@
+package yiigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+type dbConfig struct {
+	Driver               string      `json:"driver"`
+	DSN                  string      `json:"dsn"`
+	MaxOpenConns         cfgInt      `json:"max_open_conns"`
+	MaxIdleConns         cfgInt      `json:"max_idle_conns"`
+	ConnMaxIdleTime      cfgDuration `json:"conn_max_idle_time"`
+	ConnMaxLifetime      cfgDuration `json:"conn_max_lifetime"`
+	Replicas             cfgStrings  `json:"replicas"`
+	ReplicaPolicy        string      `json:"replica_policy"`
+	ReplicaCheckInterval cfgDuration `json:"replica_check_interval"`
+	QueryLogger          string      `json:"query_logger"`
+	SlowThreshold        cfgDuration `json:"slow_threshold"`
+}
+
+type mongoConfig struct {
+	DSN           string      `json:"dsn"`
+	AppName       string      `json:"app_name"`
+	CommandLogger string      `json:"command_logger"`
+	SlowThreshold cfgDuration `json:"slow_threshold"`
+	PoolMonitor   cfgBool     `json:"pool_monitor"`
+}
+
+type poolConfig struct {
+	Size        cfgInt      `json:"size"`
+	Limit       cfgInt      `json:"limit"`
+	IdleTimeout cfgDuration `json:"idle_timeout"`
+	Prefill     cfgInt      `json:"prefill"`
+}
+
+type redisConfig struct {
+	Address      string          `json:"address"`
+	Password     string          `json:"password"`
+	Database     cfgInt          `json:"database"`
+	ConnTimeout  cfgDuration     `json:"conn_timeout"`
+	ReadTimeout  cfgDuration     `json:"read_timeout"`
+	WriteTimeout cfgDuration     `json:"write_timeout"`
+	Pool         *poolConfig     `json:"pool"`
+	Sentinel     *sentinelConfig `json:"sentinel"`
+}
+
+type sentinelConfig struct {
+	Master string     `json:"master"`
+	Addrs  cfgStrings `json:"addrs"`
+}
+
+type nsqConfig struct {
+	NSQD                    string      `json:"nsqd"`
+	Lookupd                 cfgStrings  `json:"lookupd"`
+	LookupdPollInterval     cfgDuration `json:"lookupd_poll_interval"`
+	RDYRedistributeInterval cfgDuration `json:"rdy_redistribute_interval"`
+	MaxInFlight             cfgInt      `json:"max_in_flight"`
+}
+
+type loggerConfig struct {
+	Path       string  `json:"path"`
+	MaxSize    cfgInt  `json:"max_size"`
+	MaxBackups cfgInt  `json:"max_backups"`
+	MaxAge     cfgInt  `json:"max_age"`
+	Compress   cfgBool `json:"compress"`
+	Stderr     cfgBool `json:"stderr"`
+}
+
+type config struct {
+	Logger map[string]*loggerConfig `json:"logger"`
+	DB     map[string]*dbConfig     `json:"db"`
+	Mongo  map[string]*mongoConfig  `json:"mongo"`
+	Redis  map[string]*redisConfig  `json:"redis"`
+	NSQ    *nsqConfig               `json:"nsq"`
+}
+
+// LoadConfig reads the config file and returns the equivalent init options, the format is decided by the file extension:
+// .yaml, .yml, .toml, .json, .env
+//
+// The values support `${ENV_VAR}` and `${ENV_VAR:-default}` interpolation, use `LoadEnv` to load the env file first.
+// For the .env file, the sections are flattened with dots, eg: redis.default.pool.size=10
+//
+//	logger:
+//	  default:
+//	    path: app.log
+//	    max_size: 100
+//	db:
+//	  default:
+//	    driver: mysql
+//	    dsn: ${DB_DSN}
+//	    max_open_conns: 20
+//	    conn_max_lifetime: 10m
+//	    replicas: [replica_dsn]
+//	mongo:
+//	  default:
+//	    dsn: mongodb://localhost:27017
+//	    app_name: demo
+//	    command_logger: default
+//	    slow_threshold: 500ms
+//	redis:
+//	  default:
+//	    address: 127.0.0.1:6379
+//	    password: ${REDIS_PASSWORD}
+//	    read_timeout: 5s
+//	    pool:
+//	      size: 10
+//	      limit: 20
+//	  cache:
+//	    sentinel:
+//	      master: mymaster
+//	      addrs: [127.0.0.1:26379, 127.0.0.1:26380]
+//	nsq:
+//	  nsqd: 127.0.0.1:4150
+//	  lookupd: [127.0.0.1:4161]
+//	  max_in_flight: 1000
+func LoadConfig(path string) ([]InitOption, error) {
+	path = filepath.Clean(path)
+
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]interface{})
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &doc)
+	case ".toml":
+		_, err = toml.Decode(string(b), &doc)
+	case ".json":
+		err = json.Unmarshal(b, &doc)
+	case ".env":
+		doc, err = parseEnvConfig(string(b))
+	default:
+		err = fmt.Errorf("yiigo: unsupported config format %s", ext)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = json.Marshal(expandConfig(doc))
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(config)
+
+	if err = json.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg.options()
+}
+
+// InitFromConfig yiigo initialization from the config file (see `LoadConfig`),
+// the options are applied after the config, eg: yiigo.WithNSQOptions(yiigo.WithNSQConsumer(...)).
+func InitFromConfig(path string, options ...InitOption) error {
+	cfgOptions, err := LoadConfig(path)
+
+	if err != nil {
+		return err
+	}
+
+	return InitE(append(cfgOptions, options...)...)
+}
+
+func (c *config) options() ([]InitOption, error) {
+	options := make([]InitOption, 0)
+
+	for _, name := range sortedNames(c.Logger) {
+		v := c.Logger[name]
+
+		if v == nil {
+			v = new(loggerConfig)
+		}
+
+		opts := make([]LoggerOption, 0)
+
+		if v.MaxSize != 0 {
+			opts = append(opts, WithLogMaxSize(int(v.MaxSize)))
+		}
+
+		if v.MaxBackups != 0 {
+			opts = append(opts, WithLogMaxBackups(int(v.MaxBackups)))
+		}
+
+		if v.MaxAge != 0 {
+			opts = append(opts, WithLogMaxAge(int(v.MaxAge)))
+		}
+
+		if v.Compress {
+			opts = append(opts, WithLogCompress())
+		}
+
+		if v.Stderr {
+			opts = append(opts, WithLogStdErr())
+		}
+
+		options = append(options, WithLogger(name, v.Path, opts...))
+	}
+
+	for _, name := range sortedNames(c.DB) {
+		v := c.DB[name]
+
+		if v == nil {
+			return nil, fmt.Errorf("yiigo: empty config db.%s", name)
+		}
+
+		opts := make([]DBOption, 0)
+
+		if v.MaxOpenConns != 0 {
+			opts = append(opts, WithDBMaxOpenConns(int(v.MaxOpenConns)))
+		}
+
+		if v.MaxIdleConns != 0 {
+			opts = append(opts, WithDBMaxIdleConns(int(v.MaxIdleConns)))
+		}
+
+		if v.ConnMaxIdleTime != 0 {
+			opts = append(opts, WithDBConnMaxIdleTime(time.Duration(v.ConnMaxIdleTime)))
+		}
+
+		if v.ConnMaxLifetime != 0 {
+			opts = append(opts, WithDBConnMaxLifetime(time.Duration(v.ConnMaxLifetime)))
+		}
+
+		if len(v.Replicas) != 0 {
+			opts = append(opts, WithDBReplicas(v.Replicas...))
+		}
+
+		switch v.ReplicaPolicy {
+		case "", "round_robin":
+		case "random":
+			opts = append(opts, WithDBReplicaPolicy(ReplicaRandom))
+		default:
+			return nil, fmt.Errorf("yiigo: invalid config db.%s.replica_policy %s", name, v.ReplicaPolicy)
+		}
+
+		if v.ReplicaCheckInterval != 0 {
+			opts = append(opts, WithDBReplicaCheckInterval(time.Duration(v.ReplicaCheckInterval)))
+		}
+
+		if len(v.QueryLogger) != 0 {
+			logOpts := make([]SQLLogOption, 0)
+
+			if v.SlowThreshold != 0 {
+				logOpts = append(logOpts, WithSQLSlowThreshold(time.Duration(v.SlowThreshold)))
+			}
+
+			opts = append(opts, WithDBQueryLogger(v.QueryLogger, logOpts...))
+		}
+
+		options = append(options, WithDB(name, DBDriver(v.Driver), v.DSN, opts...))
+	}
+
+	for _, name := range sortedNames(c.Mongo) {
+		v := c.Mongo[name]
+
+		if v == nil {
+			return nil, fmt.Errorf("yiigo: empty config mongo.%s", name)
+		}
+
+		opts := make([]MongoOption, 0)
+
+		if len(v.AppName) != 0 {
+			opts = append(opts, WithMongoAppName(v.AppName))
+		}
+
+		if len(v.CommandLogger) != 0 {
+			slow := time.Second
+
+			if v.SlowThreshold != 0 {
+				slow = time.Duration(v.SlowThreshold)
+			}
+
+			opts = append(opts, WithMongoCommandLogger(v.CommandLogger, slow))
+		}
+
+		if v.PoolMonitor {
+			opts = append(opts, WithMongoPoolMonitor())
+		}
+
+		options = append(options, WithMongo(name, v.DSN, opts...))
+	}
+
+	for _, name := range sortedNames(c.Redis) {
+		v := c.Redis[name]
+
+		if v == nil {
+			return nil, fmt.Errorf("yiigo: empty config redis.%s", name)
+		}
+
+		opts := make([]RedisOption, 0)
+
+		if len(v.Password) != 0 {
+			opts = append(opts, WithRedisPassword(v.Password))
+		}
+
+		if v.Database != 0 {
+			opts = append(opts, WithRedisDatabase(int(v.Database)))
+		}
+
+		if v.ConnTimeout != 0 {
+			opts = append(opts, WithRedisConnTimeout(time.Duration(v.ConnTimeout)))
+		}
+
+		if v.ReadTimeout != 0 {
+			opts = append(opts, WithRedisReadTimeout(time.Duration(v.ReadTimeout)))
+		}
+
+		if v.WriteTimeout != 0 {
+			opts = append(opts, WithRedisWriteTimeout(time.Duration(v.WriteTimeout)))
+		}
+
+		if v.Pool != nil {
+			poolOpts := make([]PoolOption, 0)
+
+			if v.Pool.Size != 0 {
+				poolOpts = append(poolOpts, WithPoolSize(int(v.Pool.Size)))
+			}
+
+			if v.Pool.Limit != 0 {
+				poolOpts = append(poolOpts, WithPoolLimit(int(v.Pool.Limit)))
+			}
+
+			if v.Pool.IdleTimeout != 0 {
+				poolOpts = append(poolOpts, WithPoolIdleTimeout(time.Duration(v.Pool.IdleTimeout)))
+			}
+
+			if v.Pool.Prefill != 0 {
+				poolOpts = append(poolOpts, WithPoolPrefill(int(v.Pool.Prefill)))
+			}
+
+			opts = append(opts, WithRedisPool(poolOpts...))
+		}
+
+		if v.Sentinel != nil {
+			opts = append(opts, WithRedisSentinel(v.Sentinel.Master, v.Sentinel.Addrs...))
+		}
+
+		options = append(options, WithRedis(name, v.Address, opts...))
+	}
+
+	if v := c.NSQ; v != nil {
+		opts := make([]NSQOption, 0)
+
+		if v.LookupdPollInterval != 0 {
+			opts = append(opts, WithLookupdPollInterval(time.Duration(v.LookupdPollInterval)))
+		}
+
+		if v.RDYRedistributeInterval != 0 {
+			opts = append(opts, WithRDYRedistributeInterval(time.Duration(v.RDYRedistributeInterval)))
+		}
+
+		if v.MaxInFlight != 0 {
+			opts = append(opts, WithMaxInFlight(int(v.MaxInFlight)))
+		}
+
+		options = append(options, WithNSQ(v.NSQD, v.Lookupd, opts...))
+	}
+
+	return options, nil
+}
+
+// parseEnvConfig parses the flattened .env config into sections, eg: redis.default.pool.size=10
+// The values are not expanded by dotenv, so that `${ENV_VAR:-default}` works as the other formats.
+func parseEnvConfig(s string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		idx := strings.Index(line, "=")
+
+		if idx == -1 {
+			return nil, fmt.Errorf("yiigo: invalid config line %d: %s", i+1, line)
+		}
+
+		k := strings.TrimSpace(strings.TrimPrefix(line[:idx], "export "))
+		v := strings.TrimSpace(line[idx+1:])
+
+		if n := len(v); n >= 2 && (v[0] == '"' || v[0] == '\'') && v[n-1] == v[0] {
+			v = v[1 : n-1]
+		}
+
+		keys := strings.Split(k, ".")
+		node := doc
+
+		for j, key := range keys {
+			if j == len(keys)-1 {
+				node[key] = v
+
+				break
+			}
+
+			child, ok := node[key].(map[string]interface{})
+
+			if !ok {
+				child = make(map[string]interface{})
+				node[key] = child
+			}
+
+			node = child
+		}
+	}
+
+	return doc, nil
+}
+
+var envPlaceholderRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandConfig replaces the `${ENV_VAR}` and `${ENV_VAR:-default}` in string values with the env.
+func expandConfig(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case string:
+		return envPlaceholderRegexp.ReplaceAllStringFunc(vv, func(s string) string {
+			matches := envPlaceholderRegexp.FindStringSubmatch(s)
+
+			if env, ok := os.LookupEnv(matches[1]); ok && (len(env) != 0 || len(matches[2]) == 0) {
+				return env
+			}
+
+			return matches[3]
+		})
+	case map[string]interface{}:
+		for k, item := range vv {
+			vv[k] = expandConfig(item)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(vv))
+
+		for k, item := range vv {
+			m[fmt.Sprintf("%v", k)] = expandConfig(item)
+		}
+
+		return m
+	case []interface{}:
+		for i, item := range vv {
+			vv[i] = expandConfig(item)
+		}
+	case []map[string]interface{}:
+		for _, item := range vv {
+			expandConfig(item)
+		}
+	}
+
+	return v
+}
+
+func sortedNames(m interface{}) []string {
+	keys := make([]string, 0)
+
+	switch v := m.(type) {
+	case map[string]*loggerConfig:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*dbConfig:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*mongoConfig:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*redisConfig:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// cfgInt an int which can be decoded from a number or a string.
+type cfgInt int
+
+func (i *cfgInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+
+	if len(s) == 0 || s == "null" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(s)
+
+	if err != nil {
+		return fmt.Errorf("yiigo: invalid config int %s", string(b))
+	}
+
+	*i = cfgInt(n)
+
+	return nil
+}
+
+// cfgBool a bool which can be decoded from a bool or a string.
+type cfgBool bool
+
+func (v *cfgBool) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+
+	if len(s) == 0 || s == "null" {
+		return nil
+	}
+
+	ok, err := strconv.ParseBool(s)
+
+	if err != nil {
+		return fmt.Errorf("yiigo: invalid config bool %s", string(b))
+	}
+
+	*v = cfgBool(ok)
+
+	return nil
+}
+
+// cfgDuration a duration which can be decoded from a duration string (eg: 10s), or a number of seconds.
+type cfgDuration time.Duration
+
+func (d *cfgDuration) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+
+	if len(s) == 0 || s == "null" {
+		return nil
+	}
+
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = cfgDuration(time.Duration(n * float64(time.Second)))
+
+		return nil
+	}
+
+	t, err := time.ParseDuration(s)
+
+	if err != nil {
+		return fmt.Errorf("yiigo: invalid config duration %s", string(b))
+	}
+
+	*d = cfgDuration(t)
+
+	return nil
+}
+
+// cfgStrings a string slice which can be decoded from an array or a comma-separated string.
+type cfgStrings []string
+
+func (v *cfgStrings) UnmarshalJSON(b []byte) error {
+	var list []string
+
+	if err := json.Unmarshal(b, &list); err == nil {
+		*v = list
+
+		return nil
+	}
+
+	var s string
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("yiigo: invalid config string list %s", string(b))
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			*v = append(*v, item)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package yiigo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var configDocs = map[string]string{
+	"yiigo.yaml": `
+logger:
+  default:
+    path: app.log
+    max_size: 100
+    compress: true
+db:
+  default:
+    driver: mysql
+    dsn: ${YIIGO_TEST_DSN}
+    max_open_conns: 20
+    conn_max_lifetime: 10m
+    replicas: [replica_0, replica_1]
+mongo:
+  default:
+    dsn: mongodb://localhost:27017
+    app_name: demo
+    command_logger: default
+    slow_threshold: 500ms
+    pool_monitor: true
+redis:
+  default:
+    address: ${YIIGO_TEST_REDIS:-127.0.0.1:6379}
+    password: secret
+    read_timeout: 5s
+    pool:
+      size: 10
+      limit: 20
+    sentinel:
+      master: mymaster
+      addrs: [127.0.0.1:26379]
+nsq:
+  nsqd: 127.0.0.1:4150
+  lookupd: [127.0.0.1:4161]
+  max_in_flight: 1000
+`,
+	"yiigo.toml": `
+[logger.default]
+path = "app.log"
+max_size = 100
+compress = true
+
+[db.default]
+driver = "mysql"
+dsn = "${YIIGO_TEST_DSN}"
+max_open_conns = 20
+conn_max_lifetime = "10m"
+replicas = ["replica_0", "replica_1"]
+
+[mongo.default]
+dsn = "mongodb://localhost:27017"
+app_name = "demo"
+command_logger = "default"
+slow_threshold = "500ms"
+pool_monitor = true
+
+[redis.default]
+address = "${YIIGO_TEST_REDIS:-127.0.0.1:6379}"
+password = "secret"
+read_timeout = "5s"
+
+[redis.default.pool]
+size = 10
+limit = 20
+
+[redis.default.sentinel]
+master = "mymaster"
+addrs = ["127.0.0.1:26379"]
+
+[nsq]
+nsqd = "127.0.0.1:4150"
+lookupd = ["127.0.0.1:4161"]
+max_in_flight = 1000
+`,
+	"yiigo.json": `{
+	"logger": {"default": {"path": "app.log", "max_size": 100, "compress": true}},
+	"db": {"default": {"driver": "mysql", "dsn": "${YIIGO_TEST_DSN}", "max_open_conns": 20, "conn_max_lifetime": "10m", "replicas": ["replica_0", "replica_1"]}},
+	"mongo": {"default": {"dsn": "mongodb://localhost:27017", "app_name": "demo", "command_logger": "default", "slow_threshold": "500ms", "pool_monitor": true}},
+	"redis": {"default": {"address": "${YIIGO_TEST_REDIS:-127.0.0.1:6379}", "password": "secret", "read_timeout": "5s", "pool": {"size": 10, "limit": 20}, "sentinel": {"master": "mymaster", "addrs": ["127.0.0.1:26379"]}}},
+	"nsq": {"nsqd": "127.0.0.1:4150", "lookupd": ["127.0.0.1:4161"], "max_in_flight": 1000}
+}`,
+	"yiigo.env": `
+logger.default.path=app.log
+logger.default.max_size=100
+logger.default.compress=true
+db.default.driver=mysql
+db.default.dsn=${YIIGO_TEST_DSN}
+db.default.max_open_conns=20
+db.default.conn_max_lifetime=10m
+db.default.replicas=replica_0,replica_1
+mongo.default.dsn=mongodb://localhost:27017
+mongo.default.app_name=demo
+mongo.default.command_logger=default
+mongo.default.slow_threshold=500ms
+mongo.default.pool_monitor=true
+redis.default.address=${YIIGO_TEST_REDIS:-127.0.0.1:6379}
+redis.default.password=secret
+redis.default.read_timeout=5s
+redis.default.pool.size=10
+redis.default.pool.limit=20
+redis.default.sentinel.master=mymaster
+redis.default.sentinel.addrs=127.0.0.1:26379
+nsq.nsqd=127.0.0.1:4150
+nsq.lookupd=127.0.0.1:4161
+nsq.max_in_flight=1000
+`,
+}
+
+func TestLoadConfig(t *testing.T) {
+	os.Setenv("YIIGO_TEST_DSN", "root:secret@tcp(localhost:3306)/test")
+	defer os.Unsetenv("YIIGO_TEST_DSN")
+
+	dir := t.TempDir()
+
+	for filename, doc := range configDocs {
+		path := filepath.Join(dir, filename)
+
+		assert.Nil(t, ioutil.WriteFile(path, []byte(doc), 0644))
+
+		options, err := LoadConfig(path)
+
+		if !assert.Nil(t, err, filename) {
+			continue
+		}
+
+		setting := new(initSetting)
+
+		for _, f := range options {
+			f(setting)
+		}
+
+		// logger
+		assert.Equal(t, 1, len(setting.logger), filename)
+		assert.Equal(t, "app.log", setting.logger[0].path, filename)
+
+		ls := new(loggerSetting)
+
+		for _, f := range setting.logger[0].options {
+			f(ls)
+		}
+
+		assert.Equal(t, &loggerSetting{maxSize: 100, compress: true}, ls, filename)
+
+		// db
+		assert.Equal(t, 1, len(setting.db), filename)
+		assert.Equal(t, MySQL, setting.db[0].driver, filename)
+		assert.Equal(t, "root:secret@tcp(localhost:3306)/test", setting.db[0].dsn, filename)
+
+		ds := new(dbSetting)
+
+		for _, f := range setting.db[0].options {
+			f(ds)
+		}
+
+		assert.Equal(t, 20, ds.maxOpenConns, filename)
+		assert.Equal(t, 10*time.Minute, ds.connMaxLifetime, filename)
+		assert.Equal(t, []string{"replica_0", "replica_1"}, ds.replicas, filename)
+
+		// mongo
+		assert.Equal(t, 1, len(setting.mongo), filename)
+		assert.Equal(t, "mongodb://localhost:27017", setting.mongo[0].dsn, filename)
+
+		ms := new(mongoSetting)
+
+		for _, f := range setting.mongo[0].options {
+			f(ms)
+		}
+
+		assert.Equal(t, &mongoSetting{
+			appName: "demo",
+			commandLog: &mongoCommandLogSetting{
+				logger: "default",
+				slow:   500 * time.Millisecond,
+			},
+			poolStats: true,
+		}, ms, filename)
+
+		// redis
+		assert.Equal(t, 1, len(setting.redis), filename)
+		assert.Equal(t, "127.0.0.1:6379", setting.redis[0].address, filename)
+
+		rs := &redisSetting{pool: new(poolSetting)}
+
+		for _, f := range setting.redis[0].options {
+			f(rs)
+		}
+
+		assert.Equal(t, &redisSetting{
+			password:    "secret",
+			readTimeout: 5 * time.Second,
+			pool: &poolSetting{
+				size:  10,
+				limit: 20,
+			},
+			// the default check interval is set by newRedisSetting
+			sentinel: &sentinelSetting{
+				master: "mymaster",
+				addrs:  []string{"127.0.0.1:26379"},
+			},
+		}, rs, filename)
+
+		// nsq
+		assert.Equal(t, "127.0.0.1:4150", setting.nsq.nsqd, filename)
+		assert.Equal(t, []string{"127.0.0.1:4161"}, setting.nsq.lookupd, filename)
+
+		ns := new(nsqSetting)
+
+		for _, f := range setting.nsq.options {
+			f(ns)
+		}
+
+		assert.Equal(t, 1000, ns.maxInFlight, filename)
+	}
+}
+
+func TestLoadConfigError(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "yiigo.ini")
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("[db]"), 0644))
+
+	_, err := LoadConfig(path)
+
+	assert.NotNil(t, err)
+
+	path = filepath.Join(dir, "yiigo.json")
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"redis": {"default": {"database": "one"}}}`), 0644))
+
+	_, err = LoadConfig(path)
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,355 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	entsql "entgo.io/ent/dialect/sql"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	// mysql driver
+	_ "github.com/go-sql-driver/mysql"
+	// postgres driver
+	_ "github.com/lib/pq"
+	// sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DBDriver db driver
+type DBDriver string
+
+const (
+	// MySQL mysql driver
+	MySQL DBDriver = "mysql"
+	// Postgres postgres driver
+	Postgres DBDriver = "postgres"
+	// SQLite sqlite driver
+	SQLite DBDriver = "sqlite3"
+)
+
+type dbSetting struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxIdleTime time.Duration
+	connMaxLifetime time.Duration
+	replicas        []string
+	replicaPolicy   ReplicaPolicy
+	replicaCheck    time.Duration
+	sqlLog          *sqlLogSetting
+}
+
+// DBOption configures how we set up the db.
+type DBOption func(s *dbSetting)
+
+// WithDBMaxOpenConns specifies the `MaxOpenConns` for db.
+func WithDBMaxOpenConns(n int) DBOption {
+	return func(s *dbSetting) {
+		s.maxOpenConns = n
+	}
+}
+
+// WithDBMaxIdleConns specifies the `MaxIdleConns` for db.
+func WithDBMaxIdleConns(n int) DBOption {
+	return func(s *dbSetting) {
+		s.maxIdleConns = n
+	}
+}
+
+// WithDBConnMaxIdleTime specifies the `ConnMaxIdleTime` for db.
+func WithDBConnMaxIdleTime(t time.Duration) DBOption {
+	return func(s *dbSetting) {
+		s.connMaxIdleTime = t
+	}
+}
+
+// WithDBConnMaxLifetime specifies the `ConnMaxLifetime` for db.
+func WithDBConnMaxLifetime(t time.Duration) DBOption {
+	return func(s *dbSetting) {
+		s.connMaxLifetime = t
+	}
+}
+
+var (
+	defaultDB  *RWDB
+	dbMap      sync.Map
+	defaultEnt *entsql.Driver
+	entMap     sync.Map
+)
+
+func dbOpen(driver DBDriver, dsn string, setting *dbSetting) (*sql.DB, error) {
+	var (
+		db  *sql.DB
+		err error
+	)
+
+	if setting.sqlLog != nil {
+		connector, err := newSQLLogConnector(string(driver), dsn, setting.sqlLog)
+
+		if err != nil {
+			return nil, err
+		}
+
+		db = sql.OpenDB(connector)
+	} else {
+		if db, err = sql.Open(string(driver), dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	db.SetMaxOpenConns(setting.maxOpenConns)
+	db.SetMaxIdleConns(setting.maxIdleConns)
+	db.SetConnMaxIdleTime(setting.connMaxIdleTime)
+	db.SetConnMaxLifetime(setting.connMaxLifetime)
+
+	return db, nil
+}
+
+func dbPing(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return db.PingContext(ctx)
+}
+
+func dbDial(driver DBDriver, dsn string, setting *dbSetting) (*sql.DB, error) {
+	db, err := dbOpen(driver, dsn, setting)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// verify connection
+	if err = dbPing(db); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func initDB(name string, driver DBDriver, dsn string, options ...DBOption) error {
+	setting := &dbSetting{
+		maxOpenConns:    20,
+		maxIdleConns:    10,
+		connMaxIdleTime: 60 * time.Second,
+		connMaxLifetime: 10 * time.Minute,
+		replicaCheck:    10 * time.Second,
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	if setting.sqlLog != nil {
+		setting.sqlLog.db = name
+	}
+
+	db, err := dbDial(driver, dsn, setting)
+
+	if err != nil {
+		return err
+	}
+
+	rwdb, err := newRWDB(name, sqlx.NewDb(db, string(driver)), setting)
+
+	if err != nil {
+		db.Close()
+
+		return err
+	}
+
+	// ent always runs on the primary
+	entDriver := entsql.OpenDB(string(driver), db)
+
+	if name == Default {
+		defaultDB = rwdb
+		defaultEnt = entDriver
+	}
+
+	dbMap.Store(name, rwdb)
+	entMap.Store(name, entDriver)
+
+	logger.Info(fmt.Sprintf("[yiigo] db.%s is OK", name))
+
+	return nil
+}
+
+// DB returns a db, reads go to the replicas (if any) and writes go to the primary.
+func DB(name ...string) *RWDB {
+	if len(name) == 0 || name[0] == Default {
+		if defaultDB == nil {
+			logger.Panic(fmt.Sprintf("[yiigo] unknown db.%s (forgotten configure?)", Default))
+		}
+
+		return defaultDB
+	}
+
+	v, ok := dbMap.Load(name[0])
+
+	if !ok {
+		logger.Panic(fmt.Sprintf("[yiigo] unknown db.%s (forgotten configure?)", name[0]))
+	}
+
+	return v.(*RWDB)
+}
+
+// EntDriver returns an ent dialect.Driver.
+func EntDriver(name ...string) *entsql.Driver {
+	if len(name) == 0 || name[0] == Default {
+		if defaultEnt == nil {
+			logger.Panic(fmt.Sprintf("[yiigo] unknown db.%s (forgotten configure?)", Default))
+		}
+
+		return defaultEnt
+	}
+
+	v, ok := entMap.Load(name[0])
+
+	if !ok {
+		logger.Panic(fmt.Sprintf("[yiigo] unknown db.%s (forgotten configure?)", name[0]))
+	}
+
+	return v.(*entsql.Driver)
+}
+
+type txSetting struct {
+	isolation sql.IsolationLevel
+	readOnly  bool
+}
+
+// TxOption configures how we set up the transaction.
+type TxOption func(s *txSetting)
+
+// WithTxIsolation specifies the isolation level for transaction.
+func WithTxIsolation(level sql.IsolationLevel) TxOption {
+	return func(s *txSetting) {
+		s.isolation = level
+	}
+}
+
+// WithTxReadOnly specifies the transaction is read-only.
+func WithTxReadOnly() TxOption {
+	return func(s *txSetting) {
+		s.readOnly = true
+	}
+}
+
+// TxFunc the function that runs in transaction, the ctx should be passed to the nested `Transaction` calls.
+type TxFunc func(ctx context.Context, tx *sqlx.Tx) error
+
+type txCtxKey struct{}
+
+type txContext struct {
+	db    *sqlx.DB
+	tx    *sqlx.Tx
+	depth int
+}
+
+// Transaction executes fn in a transaction, it rolls back when fn returns an error or panics, and commits otherwise.
+// When called with the ctx of an outer transaction on the same db, it runs in a savepoint of the outer transaction,
+// and the options are ignored.
+func Transaction(ctx context.Context, db *sqlx.DB, fn TxFunc, options ...TxOption) error {
+	if v, ok := ctx.Value(txCtxKey{}).(*txContext); ok && v.db == db {
+		return savepoint(ctx, v, fn)
+	}
+
+	setting := new(txSetting)
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{
+		Isolation: setting.isolation,
+		ReadOnly:  setting.readOnly,
+	})
+
+	if err != nil {
+		logger.Error("[yiigo] tx begin error", zap.Error(err))
+
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			txRollback(tx)
+
+			logger.Error("[yiigo] tx panic", zap.Any("error", r), zap.ByteString("stack", debug.Stack()))
+
+			panic(r)
+		}
+	}()
+
+	if err = fn(context.WithValue(ctx, txCtxKey{}, &txContext{db: db, tx: tx}), tx); err != nil {
+		txRollback(tx)
+
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		logger.Error("[yiigo] tx commit error", zap.Error(err))
+
+		return err
+	}
+
+	return nil
+}
+
+func savepoint(ctx context.Context, parent *txContext, fn TxFunc) error {
+	tc := &txContext{
+		db:    parent.db,
+		tx:    parent.tx,
+		depth: parent.depth + 1,
+	}
+
+	name := fmt.Sprintf("yiigo_sp_%d", tc.depth)
+
+	if _, err := tc.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		logger.Error("[yiigo] tx savepoint error", zap.String("savepoint", name), zap.Error(err))
+
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			savepointRollback(tc.tx, name)
+
+			logger.Error("[yiigo] tx panic", zap.Any("error", r), zap.String("savepoint", name), zap.ByteString("stack", debug.Stack()))
+
+			panic(r)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txCtxKey{}, tc), tc.tx); err != nil {
+		savepointRollback(tc.tx, name)
+
+		return err
+	}
+
+	if _, err := tc.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		logger.Error("[yiigo] tx release savepoint error", zap.String("savepoint", name), zap.Error(err))
+
+		return err
+	}
+
+	return nil
+}
+
+func txRollback(tx *sqlx.Tx) {
+	if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		logger.Error("[yiigo] tx rollback error", zap.Error(err))
+	}
+}
+
+func savepointRollback(tx *sqlx.Tx, name string) {
+	// the ctx of fn may be canceled, rollback with background
+	if _, err := tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT "+name); err != nil {
+		logger.Error("[yiigo] tx rollback savepoint error", zap.String("savepoint", name), zap.Error(err))
+	}
+}
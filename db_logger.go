@@ -0,0 +1,370 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type sqlLogSetting struct {
+	db       string
+	logger   string
+	slow     time.Duration
+	redactor func(query string, args []interface{}) []interface{}
+}
+
+// SQLLogOption configures how we set up the sql logging.
+type SQLLogOption func(s *sqlLogSetting)
+
+// WithSQLSlowThreshold specifies the threshold over which the statements are logged at warn level as slow queries, default: 1s.
+func WithSQLSlowThreshold(t time.Duration) SQLLogOption {
+	return func(s *sqlLogSetting) {
+		s.slow = t
+	}
+}
+
+// WithSQLArgsRedactor specifies the function which redacts the args before logging, eg: hide the passwords.
+func WithSQLArgsRedactor(fn func(query string, args []interface{}) []interface{}) SQLLogOption {
+	return func(s *sqlLogSetting) {
+		s.redactor = fn
+	}
+}
+
+// WithDBQueryLogger logs every statement of db (including the ent driver) through the named yiigo logger,
+// with the sql, args, duration, rows affected and caller.
+func WithDBQueryLogger(name string, options ...SQLLogOption) DBOption {
+	return func(s *dbSetting) {
+		s.sqlLog = &sqlLogSetting{
+			logger: name,
+			slow:   time.Second,
+		}
+
+		for _, f := range options {
+			f(s.sqlLog)
+		}
+	}
+}
+
+var yiigoPkgPath = reflect.TypeOf(sqlLogSetting{}).PkgPath()
+
+func (s *sqlLogSetting) log(query string, args []driver.NamedValue, start time.Time, result driver.Result, err error) {
+	// driver.ErrSkip means the statement will be retried by database/sql with prepared statement
+	if err == driver.ErrSkip {
+		return
+	}
+
+	duration := time.Since(start)
+
+	values := make([]interface{}, 0, len(args))
+
+	for _, v := range args {
+		values = append(values, v.Value)
+	}
+
+	if s.redactor != nil {
+		values = s.redactor(query, values)
+	}
+
+	fields := []zap.Field{
+		zap.String("db", s.db),
+		zap.String("sql", query),
+		zap.Any("args", values),
+		zap.String("duration", duration.String()),
+	}
+
+	if result != nil {
+		if n, err := result.RowsAffected(); err == nil {
+			fields = append(fields, zap.Int64("rows_affected", n))
+		}
+	}
+
+	fields = append(fields, zap.String("caller", sqlCaller()))
+
+	l := Logger(s.logger)
+
+	switch {
+	case err != nil:
+		l.Error("[yiigo] sql error", append(fields, zap.Error(err))...)
+	case duration >= s.slow:
+		l.Warn("[yiigo] slow sql", fields...)
+	default:
+		l.Info("[yiigo] sql", fields...)
+	}
+}
+
+// sqlCaller returns the first caller outside of database/sql, sqlx, ent and yiigo.
+func sqlCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+
+	frames := runtime.CallersFrames(pcs[:n])
+
+	caller := ""
+
+	for {
+		frame, more := frames.Next()
+
+		if !isSQLInternal(frame.Function) || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+
+		caller = fmt.Sprintf("%s:%d", frame.File, frame.Line)
+
+		if !more {
+			break
+		}
+	}
+
+	return caller
+}
+
+func isSQLInternal(fn string) bool {
+	for _, prefix := range []string{"database/sql", "github.com/jmoiron/sqlx", "entgo.io/ent", "runtime.", yiigoPkgPath + "."} {
+		if strings.HasPrefix(fn, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sqlLogConnector wraps the driver connector, so that every statement is logged.
+type sqlLogConnector struct {
+	connector driver.Connector
+	setting   *sqlLogSetting
+}
+
+func newSQLLogConnector(driverName, dsn string, setting *sqlLogSetting) (*sqlLogConnector, error) {
+	db, err := sql.Open(driverName, dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := db.Driver()
+
+	db.Close()
+
+	var connector driver.Connector = &dsnConnector{dsn: dsn, driver: d}
+
+	if dc, ok := d.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sqlLogConnector{
+		connector: connector,
+		setting:   setting,
+	}, nil
+}
+
+func (c *sqlLogConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlLogConn{Conn: conn, setting: c.setting}, nil
+}
+
+func (c *sqlLogConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type sqlLogConn struct {
+	driver.Conn
+	setting *sqlLogSetting
+}
+
+func (c *sqlLogConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+
+	if v, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = v.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlLogStmt{Stmt: stmt, conn: c, query: query, setting: c.setting}, nil
+}
+
+func (c *sqlLogConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqlLogConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if v, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return v.BeginTx(ctx, opts)
+	}
+
+	return c.Conn.Begin() // nolint: staticcheck
+}
+
+func (c *sqlLogConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	v, ok := c.Conn.(driver.ExecerContext)
+
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+
+	result, err := v.ExecContext(ctx, query, args)
+
+	c.setting.log(query, args, start, result, err)
+
+	return result, err
+}
+
+func (c *sqlLogConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	v, ok := c.Conn.(driver.QueryerContext)
+
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+
+	rows, err := v.QueryContext(ctx, query, args)
+
+	c.setting.log(query, args, start, nil, err)
+
+	return rows, err
+}
+
+func (c *sqlLogConn) Ping(ctx context.Context) error {
+	if v, ok := c.Conn.(driver.Pinger); ok {
+		return v.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (c *sqlLogConn) ResetSession(ctx context.Context) error {
+	if v, ok := c.Conn.(driver.SessionResetter); ok {
+		return v.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c *sqlLogConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+
+	return true
+}
+
+func (c *sqlLogConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return v.CheckNamedValue(nv)
+	}
+
+	return driver.ErrSkip
+}
+
+type sqlLogStmt struct {
+	driver.Stmt
+	conn    *sqlLogConn
+	query   string
+	setting *sqlLogSetting
+}
+
+func (s *sqlLogStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+
+	var (
+		result driver.Result
+		err    error
+	)
+
+	if v, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = v.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+
+		if values, err = namedValuesToValues(args); err == nil {
+			result, err = s.Stmt.Exec(values) // nolint: staticcheck
+		}
+	}
+
+	s.setting.log(s.query, args, start, result, err)
+
+	return result, err
+}
+
+func (s *sqlLogStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+
+	var (
+		rows driver.Rows
+		err  error
+	)
+
+	if v, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = v.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+
+		if values, err = namedValuesToValues(args); err == nil {
+			rows, err = s.Stmt.Query(values) // nolint: staticcheck
+		}
+	}
+
+	s.setting.log(s.query, args, start, nil, err)
+
+	return rows, err
+}
+
+func (s *sqlLogStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return v.CheckNamedValue(nv)
+	}
+
+	// database/sql falls back to the conn's checker when the stmt doesn't implement it
+	return s.conn.CheckNamedValue(nv)
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, 0, len(args))
+
+	for _, v := range args {
+		if len(v.Name) != 0 {
+			return nil, fmt.Errorf("yiigo: driver does not support the use of Named Parameters")
+		}
+
+		values = append(values, v.Value)
+	}
+
+	return values, nil
+}
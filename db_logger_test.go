@@ -0,0 +1,110 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSQLLogOption(t *testing.T) {
+	setting := new(dbSetting)
+
+	WithDBQueryLogger("sql", WithSQLSlowThreshold(100*time.Millisecond))(setting)
+
+	assert.Equal(t, "sql", setting.sqlLog.logger)
+	assert.Equal(t, 100*time.Millisecond, setting.sqlLog.slow)
+	assert.Nil(t, setting.sqlLog.redactor)
+}
+
+func TestDBQueryLogger(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+
+	logMap.Store("sql_test", zap.New(core))
+
+	Init(
+		WithDB("sql_log", SQLite, "file:yiigo_sql_log?mode=memory&cache=shared",
+			WithDBQueryLogger("sql_test", WithSQLArgsRedactor(func(query string, args []interface{}) []interface{} {
+				if strings.Contains(query, "password") {
+					return []interface{}{"***"}
+				}
+
+				return args
+			})),
+		),
+		WithDB("sql_slow", SQLite, "file:yiigo_sql_slow?mode=memory&cache=shared",
+			WithDBQueryLogger("sql_test", WithSQLSlowThreshold(0)),
+		),
+	)
+
+	db := DB("sql_log")
+	defer db.Close()
+
+	db.MustExec("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT, password TEXT)")
+
+	logs.TakeAll()
+
+	// exec
+	db.MustExec("INSERT INTO user (name, password) VALUES (?, ?)", "yiigo", "secret")
+
+	entries := logs.TakeAll()
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+
+	fields := entries[0].ContextMap()
+
+	assert.Equal(t, "sql_log", fields["db"])
+	assert.Equal(t, "INSERT INTO user (name, password) VALUES (?, ?)", fields["sql"])
+	assert.Equal(t, []interface{}{"***"}, fields["args"])
+	assert.Equal(t, int64(1), fields["rows_affected"])
+	assert.Contains(t, fields["caller"], "db_logger_test.go")
+
+	// query
+	var name string
+
+	assert.Nil(t, db.Get(&name, "SELECT name FROM user WHERE id = ?", 1))
+
+	entries = logs.TakeAll()
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, []interface{}{int64(1)}, entries[0].ContextMap()["args"])
+
+	// ent driver goes through the same hook
+	var result sql.Result
+
+	assert.Nil(t, EntDriver("sql_log").Exec(context.Background(), "UPDATE user SET name = ? WHERE id = ?", []interface{}{"ent", 1}, &result))
+
+	entries = logs.TakeAll()
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "UPDATE user SET name = ? WHERE id = ?", entries[0].ContextMap()["sql"])
+
+	// error
+	_, err := db.Exec("SELECT * FROM not_exists")
+
+	assert.NotNil(t, err)
+
+	entries = logs.TakeAll()
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+
+	// slow
+	slow := DB("sql_slow")
+	defer slow.Close()
+
+	slow.MustExec("CREATE TABLE user (id INTEGER PRIMARY KEY)")
+
+	entries = logs.TakeAll()
+
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, "[yiigo] slow sql", entries[0].Message)
+}
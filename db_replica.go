@@ -0,0 +1,272 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// ReplicaPolicy specifies how to choose a replica for reads.
+type ReplicaPolicy int
+
+const (
+	// ReplicaRoundRobin chooses the healthy replicas in turn.
+	ReplicaRoundRobin ReplicaPolicy = iota
+	// ReplicaRandom chooses a healthy replica randomly.
+	ReplicaRandom
+)
+
+// WithDBReplicas specifies the replicas for db, the replicas use the same driver and pool options as the primary.
+func WithDBReplicas(dsn ...string) DBOption {
+	return func(s *dbSetting) {
+		s.replicas = append(s.replicas, dsn...)
+	}
+}
+
+// WithDBReplicaPolicy specifies the policy of choosing replica for db, default: ReplicaRoundRobin.
+func WithDBReplicaPolicy(policy ReplicaPolicy) DBOption {
+	return func(s *dbSetting) {
+		s.replicaPolicy = policy
+	}
+}
+
+// WithDBReplicaCheckInterval specifies the interval of replica health checking for db, default: 10s.
+func WithDBReplicaCheckInterval(t time.Duration) DBOption {
+	return func(s *dbSetting) {
+		s.replicaCheck = t
+	}
+}
+
+type dbReplica struct {
+	dsn     string
+	db      *sqlx.DB
+	healthy int32
+}
+
+func (r *dbReplica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *dbReplica) setHealthy(b bool) (changed bool) {
+	var v int32
+
+	if b {
+		v = 1
+	}
+
+	return atomic.SwapInt32(&r.healthy, v) != v
+}
+
+// RWDB a db with read/write splitting.
+// Reads (Get, Select, Query*) go to the healthy replicas, writes and transactions go to the primary.
+// All the other methods of the embedded *sqlx.DB run on the primary.
+type RWDB struct {
+	*sqlx.DB
+
+	name     string
+	replicas []*dbReplica
+	policy   ReplicaPolicy
+	counter  uint64
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newRWDB(name string, primary *sqlx.DB, setting *dbSetting) (*RWDB, error) {
+	db := &RWDB{
+		DB:       primary,
+		name:     name,
+		replicas: make([]*dbReplica, 0, len(setting.replicas)),
+		policy:   setting.replicaPolicy,
+		done:     make(chan struct{}),
+	}
+
+	for _, dsn := range setting.replicas {
+		v, err := dbOpen(DBDriver(primary.DriverName()), dsn, setting)
+
+		if err != nil {
+			db.closeReplicas()
+
+			return nil, err
+		}
+
+		replica := &dbReplica{
+			dsn: dsn,
+			db:  sqlx.NewDb(v, primary.DriverName()),
+		}
+
+		// an unavailable replica should not block the startup, it will be recovered by health checking
+		if err = dbPing(v); err != nil {
+			logger.Warn("[yiigo] db replica unhealthy", zap.String("name", name), zap.Int("replica", len(db.replicas)), zap.Error(err))
+		} else {
+			replica.setHealthy(true)
+		}
+
+		db.replicas = append(db.replicas, replica)
+	}
+
+	if len(db.replicas) != 0 && setting.replicaCheck > 0 {
+		go db.watchReplicas(setting.replicaCheck)
+	}
+
+	return db, nil
+}
+
+func (db *RWDB) watchReplicas(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-ticker.C:
+			db.checkReplicas()
+		}
+	}
+}
+
+func (db *RWDB) checkReplicas() {
+	for i, v := range db.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		err := v.db.PingContext(ctx)
+
+		cancel()
+
+		if !v.setHealthy(err == nil) {
+			continue
+		}
+
+		if err != nil {
+			logger.Warn("[yiigo] db replica unhealthy", zap.String("name", db.name), zap.Int("replica", i), zap.Error(err))
+		} else {
+			logger.Info("[yiigo] db replica recovered", zap.String("name", db.name), zap.Int("replica", i))
+		}
+	}
+}
+
+func (db *RWDB) closeReplicas() {
+	for _, v := range db.replicas {
+		if err := v.db.Close(); err != nil {
+			logger.Error("[yiigo] db replica closed error", zap.String("name", db.name), zap.Error(err))
+		}
+	}
+}
+
+// Primary returns the primary db.
+func (db *RWDB) Primary() *sqlx.DB {
+	return db.DB
+}
+
+// Replica returns a healthy replica chosen by the policy, or the primary if there is no healthy replica.
+func (db *RWDB) Replica() *sqlx.DB {
+	if len(db.replicas) == 0 {
+		return db.DB
+	}
+
+	healthy := make([]*sqlx.DB, 0, len(db.replicas))
+
+	for _, v := range db.replicas {
+		if v.isHealthy() {
+			healthy = append(healthy, v.db)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return db.DB
+	}
+
+	if db.policy == ReplicaRandom {
+		return healthy[rand.Intn(len(healthy))]
+	}
+
+	n := atomic.AddUint64(&db.counter, 1)
+
+	return healthy[(n-1)%uint64(len(healthy))]
+}
+
+// Transaction executes fn in a transaction on the primary, see `yiigo.Transaction`.
+func (db *RWDB) Transaction(ctx context.Context, fn TxFunc, options ...TxOption) error {
+	return Transaction(ctx, db.DB, fn, options...)
+}
+
+// Get using a replica.
+func (db *RWDB) Get(dest interface{}, query string, args ...interface{}) error {
+	return db.Replica().Get(dest, query, args...)
+}
+
+// GetContext using a replica.
+func (db *RWDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.Replica().GetContext(ctx, dest, query, args...)
+}
+
+// Select using a replica.
+func (db *RWDB) Select(dest interface{}, query string, args ...interface{}) error {
+	return db.Replica().Select(dest, query, args...)
+}
+
+// SelectContext using a replica.
+func (db *RWDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.Replica().SelectContext(ctx, dest, query, args...)
+}
+
+// Query using a replica.
+func (db *RWDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.Replica().Query(query, args...)
+}
+
+// QueryContext using a replica.
+func (db *RWDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.Replica().QueryContext(ctx, query, args...)
+}
+
+// Queryx using a replica.
+func (db *RWDB) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return db.Replica().Queryx(query, args...)
+}
+
+// QueryxContext using a replica.
+func (db *RWDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return db.Replica().QueryxContext(ctx, query, args...)
+}
+
+// QueryRow using a replica.
+func (db *RWDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.Replica().QueryRow(query, args...)
+}
+
+// QueryRowContext using a replica.
+func (db *RWDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.Replica().QueryRowContext(ctx, query, args...)
+}
+
+// QueryRowx using a replica.
+func (db *RWDB) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	return db.Replica().QueryRowx(query, args...)
+}
+
+// QueryRowxContext using a replica.
+func (db *RWDB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return db.Replica().QueryRowxContext(ctx, query, args...)
+}
+
+// Close stops the replica health checking and closes the primary and all the replicas.
+func (db *RWDB) Close() error {
+	var err error
+
+	db.once.Do(func() {
+		close(db.done)
+
+		db.closeReplicas()
+
+		err = db.DB.Close()
+	})
+
+	return err
+}
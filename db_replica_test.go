@@ -0,0 +1,94 @@
+package yiigo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaOption(t *testing.T) {
+	setting := new(dbSetting)
+
+	options := []DBOption{
+		WithDBReplicas("replica_0", "replica_1"),
+		WithDBReplicaPolicy(ReplicaRandom),
+		WithDBReplicaCheckInterval(5 * time.Second),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &dbSetting{
+		replicas:      []string{"replica_0", "replica_1"},
+		replicaPolicy: ReplicaRandom,
+		replicaCheck:  5 * time.Second,
+	}, setting)
+}
+
+func TestRWDB(t *testing.T) {
+	Init(WithDB("rw", SQLite, "file:yiigo_primary?mode=memory&cache=shared",
+		WithDBReplicas(
+			"file:yiigo_replica_0?mode=memory&cache=shared",
+			"file:yiigo_replica_1?mode=memory&cache=shared",
+		),
+	))
+
+	db := DB("rw")
+	defer db.Close()
+
+	db.MustExec("CREATE TABLE node (name TEXT)")
+	db.MustExec("INSERT INTO node (name) VALUES (?)", "primary")
+
+	for i, v := range db.replicas {
+		v.db.MustExec("CREATE TABLE node (name TEXT)")
+		v.db.MustExec("INSERT INTO node (name) VALUES (?)", fmt.Sprintf("replica_%d", i))
+	}
+
+	var name string
+
+	// round robin over the replicas
+	assert.Nil(t, db.Get(&name, "SELECT name FROM node"))
+	assert.Equal(t, "replica_0", name)
+
+	assert.Nil(t, db.Get(&name, "SELECT name FROM node"))
+	assert.Equal(t, "replica_1", name)
+
+	assert.Nil(t, db.Get(&name, "SELECT name FROM node"))
+	assert.Equal(t, "replica_0", name)
+
+	// the unhealthy replica is skipped
+	db.replicas[0].setHealthy(false)
+
+	assert.Nil(t, db.Get(&name, "SELECT name FROM node"))
+	assert.Equal(t, "replica_1", name)
+
+	assert.Nil(t, db.Get(&name, "SELECT name FROM node"))
+	assert.Equal(t, "replica_1", name)
+
+	// fallback to the primary when no replica is healthy
+	db.replicas[1].setHealthy(false)
+
+	assert.Nil(t, db.Get(&name, "SELECT name FROM node"))
+	assert.Equal(t, "primary", name)
+
+	// the recovered replicas are back after health checking
+	db.checkReplicas()
+
+	assert.True(t, db.replicas[0].isHealthy())
+	assert.True(t, db.replicas[1].isHealthy())
+
+	// transactions go to the primary
+	db.replicas[0].setHealthy(true)
+
+	err := db.Transaction(context.Background(), func(ctx context.Context, tx *sqlx.Tx) error {
+		return tx.GetContext(ctx, &name, "SELECT name FROM node")
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "primary", name)
+}
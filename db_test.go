@@ -0,0 +1,149 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBOption(t *testing.T) {
+	setting := new(dbSetting)
+
+	options := []DBOption{
+		WithDBMaxOpenConns(20),
+		WithDBMaxIdleConns(10),
+		WithDBConnMaxIdleTime(60 * time.Second),
+		WithDBConnMaxLifetime(10 * time.Minute),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &dbSetting{
+		maxOpenConns:    20,
+		maxIdleConns:    10,
+		connMaxIdleTime: 60 * time.Second,
+		connMaxLifetime: 10 * time.Minute,
+	}, setting)
+}
+
+func TestDB(t *testing.T) {
+	Init(
+		WithDB(Default, SQLite, "file:yiigo_default?mode=memory&cache=shared", WithDBMaxOpenConns(1)),
+		WithDB("other", SQLite, "file:yiigo_other?mode=memory&cache=shared"),
+	)
+
+	_, err := DB().Exec("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT)")
+	assert.Nil(t, err)
+
+	_, err = DB().Exec("INSERT INTO user (name) VALUES (?)", "yiigo")
+	assert.Nil(t, err)
+
+	var name string
+
+	assert.Nil(t, DB().Get(&name, "SELECT name FROM user WHERE id = ?", 1))
+	assert.Equal(t, "yiigo", name)
+
+	// the other db is isolated from the default one
+	assert.NotNil(t, DB("other").Get(&name, "SELECT name FROM user WHERE id = ?", 1))
+
+	assert.Equal(t, string(SQLite), EntDriver().Dialect())
+	assert.Equal(t, DB().Primary().DB, EntDriver().DB())
+	assert.Equal(t, DB("other").Primary().DB, EntDriver("other").DB())
+}
+
+func TestTxOption(t *testing.T) {
+	setting := new(txSetting)
+
+	options := []TxOption{
+		WithTxIsolation(sql.LevelSerializable),
+		WithTxReadOnly(),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &txSetting{
+		isolation: sql.LevelSerializable,
+		readOnly:  true,
+	}, setting)
+}
+
+func TestTransaction(t *testing.T) {
+	db := sqlx.MustOpen(string(SQLite), "file:yiigo_tx?mode=memory&cache=shared")
+	defer db.Close()
+
+	db.MustExec("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT)")
+
+	ctx := context.Background()
+
+	// commit
+	err := Transaction(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO user (name) VALUES (?)", "commit")
+
+		return err
+	})
+
+	assert.Nil(t, err)
+
+	// rollback
+	errRollback := errors.New("rollback")
+
+	err = Transaction(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user (name) VALUES (?)", "rollback"); err != nil {
+			return err
+		}
+
+		return errRollback
+	})
+
+	assert.Equal(t, errRollback, err)
+
+	// panic
+	assert.Panics(t, func() {
+		Transaction(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO user (name) VALUES (?)", "panic"); err != nil {
+				return err
+			}
+
+			panic("oops")
+		})
+	})
+
+	// savepoint
+	err = Transaction(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user (name) VALUES (?)", "outer"); err != nil {
+			return err
+		}
+
+		err := Transaction(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO user (name) VALUES (?)", "inner_rollback"); err != nil {
+				return err
+			}
+
+			return errRollback
+		})
+
+		assert.Equal(t, errRollback, err)
+
+		return Transaction(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO user (name) VALUES (?)", "inner_commit")
+
+			return err
+		})
+	})
+
+	assert.Nil(t, err)
+
+	var names []string
+
+	assert.Nil(t, db.Select(&names, "SELECT name FROM user ORDER BY id ASC"))
+	assert.Equal(t, []string{"commit", "outer", "inner_commit"}, names)
+}
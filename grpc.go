@@ -2,7 +2,10 @@ package yiigo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shenghui0779/vitess_pool"
@@ -74,14 +77,34 @@ type GRPCPool interface {
 	Put(gc *GRPCConn)
 }
 
+// grpcCloser the pools created by `NewGRPCPool` and `NewNamedGRPCPool` implement it,
+// Close closes the pool and removes it from the health checking, Get fails after that.
+type grpcCloser interface {
+	Close()
+}
+
+// ErrGRPCPoolClosed is returned by Get after the pool is closed.
+var ErrGRPCPoolClosed = errors.New("yiigo: grpc pool is closed")
+
+var (
+	// grpcPools the pools for `HealthCheck` (name => *gRPCPoolResource)
+	grpcPools sync.Map
+	grpcMutex sync.Mutex
+
+	// grpcPoolSeq names the pools created by `NewGRPCPool`
+	grpcPoolSeq int64
+)
+
 // GRPCDialFunc grpc dial function
 type GRPCDialFunc func() (*grpc.ClientConn, error)
 
 type gRPCPoolResource struct {
+	name     string
 	dialFunc GRPCDialFunc
 	config   *poolSetting
 	pool     *vitess_pool.ResourcePool
 	mutex    sync.Mutex
+	closed   int32
 }
 
 func (r *gRPCPoolResource) init() {
@@ -106,6 +129,10 @@ func (r *gRPCPoolResource) init() {
 }
 
 func (r *gRPCPoolResource) Get(ctx context.Context) (*GRPCConn, error) {
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return &GRPCConn{}, ErrGRPCPoolClosed
+	}
+
 	if r.pool.IsClosed() {
 		r.init()
 	}
@@ -140,9 +167,46 @@ func (r *gRPCPoolResource) Put(conn *GRPCConn) {
 	r.pool.Put(conn)
 }
 
-// NewGRPCPool returns a new grpc pool with dial func.
+// Close closes the pool and unregisters it, it's not a method of `GRPCPool`,
+// call it by asserting the pool as interface{ Close() }.
+func (r *gRPCPoolResource) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	atomic.StoreInt32(&r.closed, 1)
+
+	r.pool.Close()
+
+	grpcMutex.Lock()
+	defer grpcMutex.Unlock()
+
+	// the name may have been taken by a new pool
+	if v, ok := grpcPools.Load(r.name); ok && v.(*gRPCPoolResource) == r {
+		grpcPools.Delete(r.name)
+	}
+}
+
+// NewGRPCPool returns a new grpc pool with dial func, and registers it for `HealthCheck` (as "grpc.pool-<n>", n is the creation order).
+// It's unregistered when closed, see `NewNamedGRPCPool`.
 func NewGRPCPool(dial GRPCDialFunc, options ...PoolOption) GRPCPool {
+	return NewNamedGRPCPool(fmt.Sprintf("pool-%d", atomic.AddInt64(&grpcPoolSeq, 1)), dial, options...)
+}
+
+// NewNamedGRPCPool returns a new grpc pool with dial func, and registers it by name for `HealthCheck` (as "grpc.<name>").
+// It replaces the registered pool with the same name, and is unregistered when closed by pool.(interface{ Close() }).Close().
+func NewNamedGRPCPool(name string, dial GRPCDialFunc, options ...PoolOption) GRPCPool {
+	rp := newGRPCPool(name, dial, options...)
+
+	grpcMutex.Lock()
+	grpcPools.Store(name, rp)
+	grpcMutex.Unlock()
+
+	return rp
+}
+
+func newGRPCPool(name string, dial GRPCDialFunc, options ...PoolOption) *gRPCPoolResource {
 	rp := &gRPCPoolResource{
+		name:     name,
 		dialFunc: dial,
 		config: &poolSetting{
 			size:        10,
@@ -1,10 +1,12 @@
 package yiigo
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
 )
 
 func TestPoolOption(t *testing.T) {
@@ -28,3 +30,63 @@ func TestPoolOption(t *testing.T) {
 		prefill:     2,
 	}, setting)
 }
+
+func TestNamedGRPCPool(t *testing.T) {
+	dial := func() (*grpc.ClientConn, error) {
+		return grpc.Dial("localhost:50051", grpc.WithInsecure())
+	}
+
+	pool := NewNamedGRPCPool("named", dial, WithPoolSize(1))
+
+	_, ok := grpcPools.Load("named")
+
+	assert.True(t, ok)
+
+	// the replaced pool doesn't unregister the new one
+	other := NewNamedGRPCPool("named", dial, WithPoolSize(1))
+
+	pool.(grpcCloser).Close()
+
+	v, ok := grpcPools.Load("named")
+
+	assert.True(t, ok)
+	assert.Equal(t, other, v)
+
+	other.(grpcCloser).Close()
+
+	_, ok = grpcPools.Load("named")
+
+	assert.False(t, ok)
+
+	_, err := other.Get(context.Background())
+
+	assert.Equal(t, ErrGRPCPoolClosed, err)
+}
+
+func TestGRPCPoolRegistered(t *testing.T) {
+	dial := func() (*grpc.ClientConn, error) {
+		return grpc.Dial("localhost:50051", grpc.WithInsecure())
+	}
+
+	pool := NewGRPCPool(dial, WithPoolSize(1))
+
+	rp := pool.(*gRPCPoolResource)
+
+	v, ok := grpcPools.Load(rp.name)
+
+	assert.True(t, ok)
+	assert.Equal(t, pool, v)
+	assert.Regexp(t, `^pool-\d+$`, rp.name)
+
+	// the names are unique
+	other := NewGRPCPool(dial, WithPoolSize(1))
+
+	assert.NotEqual(t, rp.name, other.(*gRPCPoolResource).name)
+
+	pool.(grpcCloser).Close()
+	other.(grpcCloser).Close()
+
+	_, ok = grpcPools.Load(rp.name)
+
+	assert.False(t, ok)
+}
@@ -0,0 +1,259 @@
+package yiigo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/connectivity"
+)
+
+// HealthStatus the health status of a resource.
+type HealthStatus struct {
+	// Resource eg: redis.default
+	Resource string `json:"resource"`
+	Healthy  bool   `json:"healthy"`
+	Latency  string `json:"latency"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport the health status of all the resources.
+type HealthReport struct {
+	Healthy   bool            `json:"healthy"`
+	Resources []*HealthStatus `json:"resources"`
+}
+
+type healthChecker struct {
+	resource string
+	check    func(ctx context.Context) error
+}
+
+// HealthCheck checks all the registered resources concurrently:
+//
+//	[redis] PING (every master node for the clusters)
+//	[mongodb] Ping with the client's read preference
+//	[db] PingContext of the primary
+//	[nsq] the producer Ping
+//	[grpc] the connectivity state of the pools created by `NewGRPCPool` and `NewNamedGRPCPool`
+//
+// Context with timeout can specify the timeout for checking.
+func HealthCheck(ctx context.Context) *HealthReport {
+	checkers := healthCheckers()
+
+	report := &HealthReport{
+		Healthy:   true,
+		Resources: make([]*HealthStatus, len(checkers)),
+	}
+
+	var wg sync.WaitGroup
+
+	for i, v := range checkers {
+		wg.Add(1)
+
+		go func(i int, v *healthChecker) {
+			defer wg.Done()
+
+			start := time.Now()
+
+			status := &HealthStatus{
+				Resource: v.resource,
+				Healthy:  true,
+			}
+
+			if err := v.check(ctx); err != nil {
+				status.Healthy = false
+				status.Error = err.Error()
+			}
+
+			status.Latency = time.Since(start).String()
+
+			report.Resources[i] = status
+		}(i, v)
+	}
+
+	wg.Wait()
+
+	for _, v := range report.Resources {
+		if !v.Healthy {
+			report.Healthy = false
+		}
+	}
+
+	sort.Slice(report.Resources, func(i, j int) bool {
+		return report.Resources[i].Resource < report.Resources[j].Resource
+	})
+
+	return report
+}
+
+// HealthHandler returns an http handler which serves the `HealthCheck` report as JSON,
+// with status 200 if all the resources are healthy, otherwise 503.
+// eg: http.Handle("/healthz", yiigo.HealthHandler(3*time.Second))
+func HealthHandler(timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		report := HealthCheck(ctx)
+
+		b, err := json.Marshal(report)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		if report.Healthy {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		w.Write(b)
+	})
+}
+
+func healthCheckers() []*healthChecker {
+	checkers := make([]*healthChecker, 0)
+
+	redisMap.Range(func(key, value interface{}) bool {
+		pool := value.(RedisPool)
+
+		checkers = append(checkers, &healthChecker{
+			resource: fmt.Sprintf("redis.%v", key),
+			check: func(ctx context.Context) error {
+				conn, err := pool.Get(ctx)
+
+				if err != nil {
+					return err
+				}
+
+				defer pool.Put(conn)
+
+				_, err = conn.do(ctx, "PING")
+
+				return err
+			},
+		})
+
+		return true
+	})
+
+	redisClusterMap.Range(func(key, value interface{}) bool {
+		cluster := value.(*RedisClusterClient)
+
+		for _, addr := range cluster.Nodes() {
+			pool := cluster.node(addr)
+
+			checkers = append(checkers, &healthChecker{
+				resource: fmt.Sprintf("redis.%v.%s", key, addr),
+				check: func(ctx context.Context) error {
+					conn, err := pool.Get(ctx)
+
+					if err != nil {
+						return err
+					}
+
+					defer pool.Put(conn)
+
+					_, err = conn.do(ctx, "PING")
+
+					return err
+				},
+			})
+		}
+
+		return true
+	})
+
+	mgoMap.Range(func(key, value interface{}) bool {
+		client := value.(*mongo.Client)
+
+		checkers = append(checkers, &healthChecker{
+			resource: fmt.Sprintf("mongodb.%v", key),
+			check: func(ctx context.Context) error {
+				// nil uses the client's read preference
+				return client.Ping(ctx, nil)
+			},
+		})
+
+		return true
+	})
+
+	dbMap.Range(func(key, value interface{}) bool {
+		db := value.(*RWDB)
+
+		checkers = append(checkers, &healthChecker{
+			resource: fmt.Sprintf("db.%v", key),
+			check: func(ctx context.Context) error {
+				return db.Primary().PingContext(ctx)
+			},
+		})
+
+		return true
+	})
+
+	nsqMutex.Lock()
+	p := producer
+	nsqMutex.Unlock()
+
+	if p != nil {
+		checkers = append(checkers, &healthChecker{
+			resource: "nsq.producer",
+			check: func(ctx context.Context) error {
+				return waitErr(ctx, p.Ping)
+			},
+		})
+	}
+
+	grpcPools.Range(func(key, value interface{}) bool {
+		pool := value.(*gRPCPoolResource)
+
+		checkers = append(checkers, &healthChecker{
+			resource: fmt.Sprintf("grpc.%v", key),
+			check: func(ctx context.Context) error {
+				conn, err := pool.Get(ctx)
+
+				if err != nil {
+					return err
+				}
+
+				defer pool.Put(conn)
+
+				if state := conn.GetState(); state == connectivity.TransientFailure || state == connectivity.Shutdown {
+					return fmt.Errorf("grpc conn %s is %s", conn.Target(), state)
+				}
+
+				return nil
+			},
+		})
+
+		return true
+	})
+
+	return checkers
+}
+
+// waitErr runs fn and returns its error, or ctx.Err() if ctx is done first.
+func waitErr(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
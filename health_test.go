@@ -0,0 +1,114 @@
+package yiigo
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheck(t *testing.T) {
+	Init(WithDB("health", SQLite, "file:yiigo_health?mode=memory&cache=shared"))
+
+	defer func() {
+		DB("health").Close()
+		dbMap.Delete("health")
+	}()
+
+	report := HealthCheck(context.Background())
+
+	var status *HealthStatus
+
+	for _, v := range report.Resources {
+		if v.Resource == "db.health" {
+			status = v
+		}
+	}
+
+	if assert.NotNil(t, status) {
+		assert.True(t, status.Healthy)
+		assert.Empty(t, status.Error)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	Init(WithDB("healthz", SQLite, "file:yiigo_healthz?mode=memory&cache=shared"))
+
+	db := DB("healthz")
+
+	w := httptest.NewRecorder()
+
+	HealthHandler(time.Second).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	report := new(HealthReport)
+
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), report))
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, report.Healthy, w.Code == http.StatusOK)
+
+	db.Close()
+
+	w = httptest.NewRecorder()
+
+	HealthHandler(time.Second).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), report))
+	assert.False(t, report.Healthy)
+
+	dbMap.Delete("healthz")
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	// a redis which accepts connections but never replies
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	pool := newRedis(ln.Addr().String())
+
+	redisMap.Store("health_stuck", pool)
+
+	defer func() {
+		redisMap.Delete("health_stuck")
+		pool.(redisCloser).close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+
+	defer cancel()
+
+	start := time.Now()
+
+	report := HealthCheck(ctx)
+
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+	assert.False(t, report.Healthy)
+
+	for _, v := range report.Resources {
+		if v.Resource == "redis.health_stuck" {
+			assert.False(t, v.Healthy)
+		}
+	}
+}
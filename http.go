@@ -15,9 +15,11 @@ import (
 
 // httpSetting http request setting
 type httpSetting struct {
-	headers map[string]string
-	cookies []*http.Cookie
-	close   bool
+	headers  map[string]string
+	cookies  []*http.Cookie
+	close    bool
+	limiter  RateLimiter
+	limitKey string
 }
 
 // HTTPOption configures how we set up the http request.
@@ -46,6 +48,15 @@ func WithHTTPClose() HTTPOption {
 	}
 }
 
+// WithHTTPRateLimit specifies the outbound rate limiter, the request waits for the quota of the key
+// until the context is done, eg: WithHTTPRateLimit(limiter, "api.example.com").
+func WithHTTPRateLimit(limiter RateLimiter, key string) HTTPOption {
+	return func(s *httpSetting) {
+		s.limiter = limiter
+		s.limitKey = key
+	}
+}
+
 // UploadForm is the interface for http upload
 type UploadForm interface {
 	// Write writes fields to multipart writer
@@ -174,6 +185,12 @@ func (c *httpclient) Do(ctx context.Context, method, reqURL string, body io.Read
 		req.Close = true
 	}
 
+	if setting.limiter != nil {
+		if err = RateLimitWait(ctx, setting.limiter, setting.limitKey); err != nil {
+			return nil, err
+		}
+	}
+
 	resp, err := c.client.Do(req.WithContext(ctx))
 
 	if err != nil {
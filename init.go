@@ -1,18 +1,26 @@
 package yiigo
 
 import (
+	"fmt"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+
+	"go.uber.org/zap"
 )
 
 type cfgdb struct {
-	name string
-	dsn  string
+	name    string
+	driver  DBDriver
+	dsn     string
+	options []DBOption
 }
 
 type cfgmongo struct {
-	name string
-	dsn  string
+	name    string
+	dsn     string
+	options []MongoOption
 }
 
 type cfgredis struct {
@@ -44,14 +52,30 @@ type initSetting struct {
 // InitOption configures how we set up the yiigo initialization.
 type InitOption func(s *initSetting)
 
+// WithDB register db.
+// [MySQL] username:password@tcp(localhost:3306)/dbname?timeout=10s&charset=utf8mb4&collation=utf8mb4_general_ci&parseTime=True&loc=Local
+// [Postgres] host=localhost port=5432 user=root password=secret dbname=test connect_timeout=10 sslmode=disable
+// [SQLite] file::memory:?cache=shared
+func WithDB(name string, driver DBDriver, dsn string, options ...DBOption) InitOption {
+	return func(s *initSetting) {
+		s.db = append(s.db, &cfgdb{
+			name:    name,
+			driver:  driver,
+			dsn:     dsn,
+			options: options,
+		})
+	}
+}
+
 // WithMongo register mongodb.
 // [DSN] mongodb://localhost:27017/?connectTimeoutMS=10000&minPoolSize=10&maxPoolSize=20&maxIdleTimeMS=60000&readPreference=primary
 // [reference] https://docs.mongodb.com/manual/reference/connection-string
-func WithMongo(name string, dsn string) InitOption {
+func WithMongo(name string, dsn string, options ...MongoOption) InitOption {
 	return func(s *initSetting) {
 		s.mongo = append(s.mongo, &cfgmongo{
-			name: name,
-			dsn:  dsn,
+			name:    name,
+			dsn:     dsn,
+			options: options,
 		})
 	}
 }
@@ -78,6 +102,17 @@ func WithNSQ(nsqd string, lookupd []string, options ...NSQOption) InitOption {
 	}
 }
 
+// WithNSQOptions appends the options to the registered nsq, eg: add consumers to the nsq loaded from config file.
+func WithNSQOptions(options ...NSQOption) InitOption {
+	return func(s *initSetting) {
+		if s.nsq == nil {
+			return
+		}
+
+		s.nsq.options = append(s.nsq.options, options...)
+	}
+}
+
 // WithLogger register logger.
 func WithLogger(name, logfile string, options ...LoggerOption) InitOption {
 	return func(s *initSetting) {
@@ -89,8 +124,91 @@ func WithLogger(name, logfile string, options ...LoggerOption) InitOption {
 	}
 }
 
-// Init yiigo initialization.
+// ResourceError the error of a resource initialization.
+type ResourceError struct {
+	// Resource the failed resource, eg: redis.cache
+	Resource string
+	Err      error
+}
+
+func (e *ResourceError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Resource, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+// InitError the errors of yiigo initialization, one for each failed resource.
+type InitError struct {
+	Errors []*ResourceError
+}
+
+func (e *InitError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+
+	for _, v := range e.Errors {
+		msgs = append(msgs, v.Error())
+	}
+
+	return "yiigo init error: " + strings.Join(msgs, "; ")
+}
+
+// Resources returns the failed resources.
+func (e *InitError) Resources() []string {
+	resources := make([]string, 0, len(e.Errors))
+
+	for _, v := range e.Errors {
+		resources = append(resources, v.Resource)
+	}
+
+	return resources
+}
+
+type initErrors struct {
+	errs  []*ResourceError
+	mutex sync.Mutex
+}
+
+func (e *initErrors) add(resource string, err error) {
+	if err == nil {
+		return
+	}
+
+	logger.Error("[yiigo] init error", zap.String("resource", resource), zap.Error(err))
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.errs = append(e.errs, &ResourceError{
+		Resource: resource,
+		Err:      err,
+	})
+}
+
+func (e *initErrors) err() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(e.errs, func(i, j int) bool {
+		return e.errs[i].Resource < e.errs[j].Resource
+	})
+
+	return &InitError{Errors: e.errs}
+}
+
+// Init yiigo initialization, it panics if any resource fails.
 func Init(options ...InitOption) {
+	if err := InitE(options...); err != nil {
+		logger.Panic("[yiigo] init error", zap.Error(err))
+	}
+}
+
+// InitE yiigo initialization, it initializes all the resources and returns an `*InitError`
+// which names the failed ones, so that callers can retry, degrade or report the readiness.
+func InitE(options ...InitOption) error {
 	setting := new(initSetting)
 
 	for _, f := range options {
@@ -103,11 +221,20 @@ func Init(options ...InitOption) {
 		}
 	}
 
+	errs := new(initErrors)
+
 	var wg sync.WaitGroup
 
 	if len(setting.db) != 0 {
 		wg.Add(1)
 
+		go func() {
+			defer wg.Done()
+
+			for _, v := range setting.db {
+				errs.add("db."+v.name, initDB(v.name, v.driver, v.dsn, v.options...))
+			}
+		}()
 	}
 
 	if len(setting.mongo) != 0 {
@@ -117,7 +244,7 @@ func Init(options ...InitOption) {
 			defer wg.Done()
 
 			for _, v := range setting.mongo {
-				initMongoDB(v.name, v.dsn)
+				errs.add("mongodb."+v.name, initMongoDB(v.name, v.dsn, v.options...))
 			}
 		}()
 	}
@@ -129,7 +256,7 @@ func Init(options ...InitOption) {
 			defer wg.Done()
 
 			for _, v := range setting.redis {
-				initRedis(v.name, v.address, v.options...)
+				errs.add("redis."+v.name, initRedis(v.name, v.address, v.options...))
 			}
 		}()
 	}
@@ -140,9 +267,23 @@ func Init(options ...InitOption) {
 		go func() {
 			defer wg.Done()
 
-			initNSQ(setting.nsq.nsqd, setting.nsq.lookupd, setting.nsq.options...)
+			if err := initProducer(setting.nsq.nsqd); err != nil {
+				errs.add("nsq.producer", err)
+
+				return
+			}
+
+			if err := setConsumers(setting.nsq.lookupd, setting.nsq.options...); err != nil {
+				errs.add("nsq.consumer", err)
+
+				return
+			}
+
+			logger.Info("[yiigo] nsq is OK")
 		}()
 	}
 
 	wg.Wait()
+
+	return errs.err()
 }
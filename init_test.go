@@ -0,0 +1,25 @@
+package yiigo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitE(t *testing.T) {
+	err := InitE(
+		WithDB("init_ok", SQLite, "file:yiigo_init?mode=memory&cache=shared"),
+		WithDB("init_bad", DBDriver("unknown"), "dsn"),
+		WithRedis("init_bad", "127.0.0.1:1", WithRedisConnTimeout(time.Second)),
+	)
+
+	var initErr *InitError
+
+	assert.True(t, errors.As(err, &initErr))
+	assert.Equal(t, []string{"db.init_bad", "redis.init_bad"}, initErr.Resources())
+
+	// the others are initialized
+	assert.Nil(t, DB("init_ok").Ping())
+}
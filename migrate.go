@@ -0,0 +1,530 @@
+package yiigo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration a versioned migration read from the `NNNN_name.up.sql` and `NNNN_name.down.sql` files.
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+	hasDown bool
+}
+
+// MigrationStatus the status of a migration.
+type MigrationStatus struct {
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at"`
+	// Missing reports the migration was applied but its file no longer exists.
+	Missing bool `json:"missing"`
+}
+
+type migrateSetting struct {
+	table       string
+	lockTimeout time.Duration
+	staleLock   time.Duration
+}
+
+// MigrateOption configures how we set up the migrator.
+type MigrateOption func(s *migrateSetting)
+
+// WithMigrationTable specifies the table which records the applied versions, default: yiigo_migrations.
+func WithMigrationTable(name string) MigrateOption {
+	return func(s *migrateSetting) {
+		s.table = name
+	}
+}
+
+// WithMigrationLockTimeout specifies the max duration of waiting for the migration lock, default: 60s.
+func WithMigrationLockTimeout(t time.Duration) MigrateOption {
+	return func(s *migrateSetting) {
+		s.lockTimeout = t
+	}
+}
+
+// WithMigrationStaleLock specifies the duration after which a SQLite migration lock is considered stale
+// (eg: the holder crashed) and can be taken over, default: 10m.
+func WithMigrationStaleLock(t time.Duration) MigrateOption {
+	return func(s *migrateSetting) {
+		s.staleLock = t
+	}
+}
+
+// Migrator schema migration runner, the migrations are applied under a per-dialect lock,
+// so that concurrent processes don't apply the same migration twice:
+//
+//	[MySQL] GET_LOCK
+//	[Postgres] pg_advisory_lock
+//	[SQLite] a lock row in the `<table>_lock` table
+//
+// For MySQL, a migration file with multiple statements requires `multiStatements=true` in the DSN.
+type Migrator struct {
+	db         *sqlx.DB
+	driver     DBDriver
+	source     fs.FS
+	setting    *migrateSetting
+	migrations []*Migration
+}
+
+// NewMigrator returns a new migrator which reads the migration files from source,
+// use `os.DirFS(dir)` to read from a directory.
+// eg: yiigo.NewMigrator(yiigo.DB().Primary(), os.DirFS("migrations"))
+func NewMigrator(db *sqlx.DB, source fs.FS, options ...MigrateOption) (*Migrator, error) {
+	setting := &migrateSetting{
+		table:       "yiigo_migrations",
+		lockTimeout: 60 * time.Second,
+		staleLock:   10 * time.Minute,
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	m := &Migrator{
+		db:      db,
+		driver:  DBDriver(db.DriverName()),
+		source:  source,
+		setting: setting,
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Migrator) load() error {
+	entries, err := fs.ReadDir(m.source, ".")
+
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+
+		if len(matches) == 0 {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+
+		if err != nil {
+			return fmt.Errorf("yiigo: invalid migration version %s: %w", entry.Name(), err)
+		}
+
+		b, err := fs.ReadFile(m.source, entry.Name())
+
+		if err != nil {
+			return err
+		}
+
+		migration, ok := versions[version]
+
+		if !ok {
+			migration = &Migration{
+				Version: version,
+				Name:    matches[2],
+			}
+
+			versions[version] = migration
+		}
+
+		if migration.Name != matches[2] {
+			return fmt.Errorf("yiigo: duplicate migration version %d (%s, %s)", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			migration.up = string(b)
+		} else {
+			migration.down = string(b)
+			migration.hasDown = true
+		}
+	}
+
+	m.migrations = make([]*Migration, 0, len(versions))
+
+	for _, v := range versions {
+		m.migrations = append(m.migrations, v)
+	}
+
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return nil
+}
+
+// Migrations returns the migrations in ascending order of version.
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+// MigrateUp applies all the pending migrations.
+func (m *Migrator) MigrateUp(ctx context.Context) error {
+	return m.run(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for _, v := range m.migrations {
+			if _, ok := applied[v.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, v, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown rolls back the last n applied migrations.
+func (m *Migrator) MigrateDown(ctx context.Context, n int) error {
+	return m.run(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && n > 0; i-- {
+			v := m.migrations[i]
+
+			if _, ok := applied[v.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, v, false); err != nil {
+				return err
+			}
+
+			n--
+		}
+
+		return nil
+	})
+}
+
+// MigrateTo migrates up or down to the specified version,
+// the migrations with version <= the specified version are applied, and the others are rolled back.
+func (m *Migrator) MigrateTo(ctx context.Context, version int64) error {
+	return m.run(ctx, func(conn *sql.Conn, applied map[int64]time.Time) error {
+		// roll back in descending order
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			v := m.migrations[i]
+
+			if v.Version <= version {
+				break
+			}
+
+			if _, ok := applied[v.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, v, false); err != nil {
+				return err
+			}
+		}
+
+		// apply in ascending order
+		for _, v := range m.migrations {
+			if v.Version > version {
+				break
+			}
+
+			if _, ok := applied[v.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, v, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status returns the status of all the migrations in ascending order of version.
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	conn, err := m.db.Conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err = m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx, conn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]*MigrationStatus, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+
+	for _, v := range m.migrations {
+		known[v.Version] = true
+
+		s := &MigrationStatus{
+			Version: v.Version,
+			Name:    v.Name,
+		}
+
+		if t, ok := applied[v.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = t
+		}
+
+		status = append(status, s)
+	}
+
+	for version, t := range applied {
+		if known[version] {
+			continue
+		}
+
+		status = append(status, &MigrationStatus{
+			Version:   version,
+			Applied:   true,
+			AppliedAt: t,
+			Missing:   true,
+		})
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+
+	return status, nil
+}
+
+func (m *Migrator) run(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]time.Time) error) error {
+	// the session locks are held by connection, so run everything on a dedicated one
+	conn, err := m.db.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if err = m.lock(ctx, conn); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := m.unlock(conn); err != nil {
+			logger.Error("[yiigo] migration unlock error", zap.Error(err))
+		}
+	}()
+
+	if err = m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	// read the applied versions after locked, so that the migrations applied by others are seen
+	applied, err := m.applied(ctx, conn)
+
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration, up bool) error {
+	query := migration.up
+	record := m.rebind(fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)", m.setting.table))
+	args := []interface{}{migration.Version, migration.Name, time.Now().Unix()}
+	direction := "up"
+
+	if !up {
+		if !migration.hasDown {
+			return fmt.Errorf("yiigo: migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+
+		query = migration.down
+		record = m.rebind(fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.setting.table))
+		args = []interface{}{migration.Version}
+		direction = "down"
+	}
+
+	// DDL is transactional on Postgres and SQLite, but causes an implicit commit on MySQL
+	tx, err := conn.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		tx.Rollback()
+
+		return fmt.Errorf("yiigo: migration %d_%s %s error: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("[yiigo] migration %d_%s %s is OK", migration.Version, migration.Name, direction))
+
+	return nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at BIGINT NOT NULL)", m.setting.table)
+
+	_, err := conn.ExecContext(ctx, query)
+
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, applied_at FROM %s", m.setting.table))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+
+	for rows.Next() {
+		var version, appliedAt int64
+
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		applied[version] = time.Unix(appliedAt, 0)
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, m.setting.lockTimeout)
+	defer cancel()
+
+	switch m.driver {
+	case MySQL:
+		var locked sql.NullInt64
+
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.lockName(), int(m.setting.lockTimeout.Seconds())).Scan(&locked); err != nil {
+			return err
+		}
+
+		if locked.Int64 != 1 {
+			return errors.New("yiigo: migration lock timeout")
+		}
+
+		return nil
+	case Postgres:
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey())
+
+		return err
+	case SQLite:
+		return m.sqliteLock(ctx, conn)
+	}
+
+	return fmt.Errorf("yiigo: migration unsupported driver %s", m.driver)
+}
+
+func (m *Migrator) unlock(conn *sql.Conn) error {
+	// the ctx of migrating may be canceled, unlock with background
+	ctx := context.Background()
+
+	switch m.driver {
+	case MySQL:
+		_, err := conn.ExecContext(ctx, "DO RELEASE_LOCK(?)", m.lockName())
+
+		return err
+	case Postgres:
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", m.lockKey())
+
+		return err
+	case SQLite:
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s_lock WHERE id = 1", m.setting.table))
+
+		return err
+	}
+
+	return nil
+}
+
+func (m *Migrator) sqliteLock(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_lock (id INTEGER NOT NULL PRIMARY KEY, locked_at BIGINT NOT NULL)", m.setting.table)); err != nil {
+		return err
+	}
+
+	for {
+		now := time.Now()
+
+		// take over the stale lock
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s_lock WHERE id = 1 AND locked_at < ?", m.setting.table), now.Add(-m.setting.staleLock).Unix()); err != nil {
+			return err
+		}
+
+		result, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT OR IGNORE INTO %s_lock (id, locked_at) VALUES (1, ?)", m.setting.table), now.Unix())
+
+		if err != nil {
+			return err
+		}
+
+		if n, _ := result.RowsAffected(); n == 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.New("yiigo: migration lock timeout")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (m *Migrator) lockName() string {
+	return fmt.Sprintf("%s_lock", m.setting.table)
+}
+
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(m.lockName()))
+
+	return int64(h.Sum64())
+}
+
+func (m *Migrator) rebind(query string) string {
+	return sqlx.Rebind(sqlx.BindType(string(m.driver)), query)
+}
@@ -0,0 +1,147 @@
+package yiigo
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+var migrationFS = fstest.MapFS{
+	"0001_create_user.up.sql":      {Data: []byte("CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT)")},
+	"0001_create_user.down.sql":    {Data: []byte("DROP TABLE user")},
+	"0002_add_user_age.up.sql":     {Data: []byte("ALTER TABLE user ADD COLUMN age INTEGER")},
+	"0002_add_user_age.down.sql":   {Data: []byte("ALTER TABLE user DROP COLUMN age")},
+	"0003_create_address.up.sql":   {Data: []byte("CREATE TABLE address (id INTEGER PRIMARY KEY, user_id INTEGER); CREATE INDEX idx_user_id ON address (user_id)")},
+	"0003_create_address.down.sql": {Data: []byte("DROP TABLE address")},
+	"README.md":                    {Data: []byte("ignored")},
+}
+
+func TestMigrateOption(t *testing.T) {
+	setting := new(migrateSetting)
+
+	options := []MigrateOption{
+		WithMigrationTable("migrations"),
+		WithMigrationLockTimeout(30 * time.Second),
+		WithMigrationStaleLock(5 * time.Minute),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &migrateSetting{
+		table:       "migrations",
+		lockTimeout: 30 * time.Second,
+		staleLock:   5 * time.Minute,
+	}, setting)
+}
+
+func TestMigrator(t *testing.T) {
+	db := sqlx.MustOpen(string(SQLite), filepath.Join(t.TempDir(), "migrate.db")+"?_busy_timeout=5000")
+	defer db.Close()
+
+	ctx := context.Background()
+
+	m, err := NewMigrator(db, migrationFS)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(m.Migrations()))
+
+	// up
+	assert.Nil(t, m.MigrateUp(ctx))
+	assert.Equal(t, []int64{1, 2, 3}, appliedVersions(t, m))
+
+	db.MustExec("INSERT INTO user (name, age) VALUES (?, ?)", "yiigo", 29)
+
+	// down
+	assert.Nil(t, m.MigrateDown(ctx, 2))
+	assert.Equal(t, []int64{1}, appliedVersions(t, m))
+
+	_, err = db.Exec("SELECT age FROM user")
+	assert.NotNil(t, err)
+
+	// to
+	assert.Nil(t, m.MigrateTo(ctx, 2))
+	assert.Equal(t, []int64{1, 2}, appliedVersions(t, m))
+
+	assert.Nil(t, m.MigrateTo(ctx, 0))
+	assert.Equal(t, []int64{}, appliedVersions(t, m))
+
+	// status
+	assert.Nil(t, m.MigrateTo(ctx, 1))
+
+	status, err := m.Status(ctx)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(status))
+	assert.True(t, status[0].Applied)
+	assert.Equal(t, "create_user", status[0].Name)
+	assert.False(t, status[1].Applied)
+	assert.False(t, status[2].Applied)
+}
+
+func TestMigratorConcurrent(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "migrate.db") + "?_busy_timeout=5000"
+
+	var wg sync.WaitGroup
+
+	errs := make([]error, 5)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			// each one acts as a standalone process
+			db := sqlx.MustOpen(string(SQLite), dsn)
+			defer db.Close()
+
+			m, err := NewMigrator(db, migrationFS)
+
+			if err != nil {
+				errs[i] = err
+
+				return
+			}
+
+			errs[i] = m.MigrateUp(context.Background())
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+
+	db := sqlx.MustOpen(string(SQLite), dsn)
+	defer db.Close()
+
+	var count int
+
+	assert.Nil(t, db.Get(&count, "SELECT COUNT(*) FROM yiigo_migrations"))
+	assert.Equal(t, 3, count)
+}
+
+func appliedVersions(t *testing.T, m *Migrator) []int64 {
+	status, err := m.Status(context.Background())
+
+	assert.Nil(t, err)
+
+	versions := make([]int64, 0)
+
+	for _, v := range status {
+		if v.Applied {
+			versions = append(versions, v.Version)
+		}
+	}
+
+	return versions
+}
@@ -2,13 +2,17 @@ package yiigo
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"sync"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.uber.org/zap"
 )
 
 var (
@@ -16,13 +20,158 @@ var (
 	mgoMap       sync.Map
 )
 
-func initMongoDB(name, dsn string) {
+type mongoTLSSetting struct {
+	certFile string
+	keyFile  string
+	caFile   string
+}
+
+type mongoSetting struct {
+	appName    string
+	registry   *bsoncodec.Registry
+	tls        *mongoTLSSetting
+	commandLog *mongoCommandLogSetting
+	poolStats  bool
+	indexes    *mongoIndexSetting
+
+	// poolCounter the counter of poolStats, it's registered after the client is connected
+	poolCounter *mongoPoolCounter
+}
+
+// MongoOption configures how we set up the mongodb, the options override the same ones in dsn.
+type MongoOption func(s *mongoSetting)
+
+// WithMongoAppName specifies the app name which is sent to the server and shown in the server logs and profiles.
+func WithMongoAppName(name string) MongoOption {
+	return func(s *mongoSetting) {
+		s.appName = name
+	}
+}
+
+// WithMongoRegistry specifies the BSON registry of the client, eg: the codecs of decimal or time zone.
+func WithMongoRegistry(registry *bsoncodec.Registry) MongoOption {
+	return func(s *mongoSetting) {
+		s.registry = registry
+	}
+}
+
+// WithMongoTLSFiles specifies the TLS config of the client from files (PEM),
+// certFile and keyFile are the client certificate (both empty for no client auth), caFile is the root CAs (empty for the system ones).
+func WithMongoTLSFiles(certFile, keyFile, caFile string) MongoOption {
+	return func(s *mongoSetting) {
+		s.tls = &mongoTLSSetting{
+			certFile: certFile,
+			keyFile:  keyFile,
+			caFile:   caFile,
+		}
+	}
+}
+
+// WithMongoCommandLogger logs the commands at debug level through the named yiigo logger,
+// the commands over the slow threshold are logged at warn level as slow operations, and the failed ones at error level.
+func WithMongoCommandLogger(name string, slow time.Duration) MongoOption {
+	return func(s *mongoSetting) {
+		s.commandLog = &mongoCommandLogSetting{
+			logger: name,
+			slow:   slow,
+		}
+	}
+}
+
+// WithMongoPoolMonitor collects the stats of the connection pool, which can be read by `MongoPoolStat`.
+func WithMongoPoolMonitor() MongoOption {
+	return func(s *mongoSetting) {
+		s.poolStats = true
+	}
+}
+
+func mongoClientOptions(name, dsn string, setting *mongoSetting) (*options.ClientOptions, error) {
 	opts := options.Client().ApplyURI(dsn)
 
+	if len(setting.appName) != 0 {
+		opts.SetAppName(setting.appName)
+	}
+
+	if setting.registry != nil {
+		opts.SetRegistry(setting.registry)
+	}
+
+	if setting.tls != nil {
+		cfg, err := setting.tls.config()
+
+		if err != nil {
+			return nil, err
+		}
+
+		opts.SetTLSConfig(cfg)
+	}
+
+	if setting.commandLog != nil {
+		setting.commandLog.mongo = name
+
+		opts.SetMonitor(setting.commandLog.monitor())
+	}
+
+	if setting.poolStats {
+		setting.poolCounter = new(mongoPoolCounter)
+
+		opts.SetPoolMonitor(setting.poolCounter.monitor())
+	}
+
+	return opts, nil
+}
+
+func (s *mongoTLSSetting) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(s.certFile) != 0 || len(s.keyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(s.caFile) != 0 {
+		b, err := ioutil.ReadFile(s.caFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("yiigo: no valid certificates in " + s.caFile)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+func initMongoDB(name, dsn string, options ...MongoOption) error {
+	setting := new(mongoSetting)
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	opts, err := mongoClientOptions(name, dsn, setting)
+
+	if err != nil {
+		return err
+	}
+
 	client, err := mongo.Connect(context.Background(), opts)
 
 	if err != nil {
-		logger.Panic("[yiigo] mongodb init error", zap.String("name", name), zap.Error(err))
+		return err
 	}
 
 	timeout := 10 * time.Second
@@ -36,7 +185,21 @@ func initMongoDB(name, dsn string) {
 
 	// verify connection
 	if err = client.Ping(ctx, opts.ReadPreference); err != nil {
-		logger.Panic("[yiigo] mongodb init error", zap.String("name", name), zap.Error(err))
+		client.Disconnect(context.Background())
+
+		return err
+	}
+
+	if setting.indexes != nil {
+		report, err := syncMongoIndexes(context.Background(), client, setting.indexes)
+
+		if err != nil {
+			client.Disconnect(context.Background())
+
+			return err
+		}
+
+		logMongoIndexReport(name, report)
 	}
 
 	if name == Default {
@@ -45,7 +208,13 @@ func initMongoDB(name, dsn string) {
 
 	mgoMap.Store(name, client)
 
+	if setting.poolCounter != nil {
+		mgoPoolStats.Store(name, setting.poolCounter)
+	}
+
 	logger.Info(fmt.Sprintf("[yiigo] mongodb.%s is OK", name))
+
+	return nil
 }
 
 // Mongo returns a mongo client.
@@ -0,0 +1,500 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MongoIndex the declaration of a mongo index.
+type MongoIndex struct {
+	Database   string
+	Collection string
+
+	// Name the index name, default is generated by the keys like the driver, eg: {uid: 1, created_at: -1} => uid_1_created_at_-1
+	Name string
+
+	// Keys the ordered keys, eg: bson.D{{"uid", 1}, {"created_at", -1}}
+	Keys bson.D
+
+	Unique bool
+
+	// TTL the documents expire after TTL (expireAfterSeconds), 0 means no expiration
+	TTL time.Duration
+
+	// PartialFilter the partial filter expression, eg: bson.M{"status": "active"}
+	PartialFilter interface{}
+
+	Collation *options.Collation
+}
+
+func (i *MongoIndex) name() string {
+	if len(i.Name) != 0 {
+		return i.Name
+	}
+
+	return mongoIndexKeysName(i.Keys)
+}
+
+func (i *MongoIndex) namespace() string {
+	return i.Database + "." + i.Collection
+}
+
+func (i *MongoIndex) model() mongo.IndexModel {
+	opts := options.Index().SetName(i.name())
+
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+
+	if i.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(i.TTL / time.Second))
+	}
+
+	if i.PartialFilter != nil {
+		opts.SetPartialFilterExpression(i.PartialFilter)
+	}
+
+	if i.Collation != nil {
+		opts.SetCollation(i.Collation)
+	}
+
+	return mongo.IndexModel{
+		Keys:    i.Keys,
+		Options: opts,
+	}
+}
+
+// mongoIndexKeysName returns the name of the keys, eg: {uid: 1, created_at: -1} => uid_1_created_at_-1
+func mongoIndexKeysName(keys bson.D) string {
+	parts := make([]string, 0, 2*len(keys))
+
+	for _, e := range keys {
+		var value string
+
+		switch v := e.Value.(type) {
+		case int:
+			value = strconv.Itoa(v)
+		case int32:
+			value = strconv.FormatInt(int64(v), 10)
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+
+		parts = append(parts, e.Key, value)
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// mongoIndexKeySpec returns the comparable spec of the keys. The server stores the text fields of a text index
+// as {_fts: "text", _ftsx: 1} with the fields in weights, so they are compared as the sorted field names,
+// eg: {uid: 1, title: "text", content: "text"} => uid_1_text(content,title)
+func mongoIndexKeySpec(keys, weights bson.D) string {
+	var (
+		prefix bson.D
+		suffix bson.D
+		texts  []string
+	)
+
+	for _, e := range keys {
+		switch {
+		case e.Key == "_fts":
+			for _, w := range weights {
+				texts = append(texts, w.Key)
+			}
+		case e.Key == "_ftsx":
+		case e.Value == "text":
+			texts = append(texts, e.Key)
+		case len(texts) != 0:
+			suffix = append(suffix, e)
+		default:
+			prefix = append(prefix, e)
+		}
+	}
+
+	if len(texts) == 0 {
+		return mongoIndexKeysName(keys)
+	}
+
+	sort.Strings(texts)
+
+	parts := make([]string, 0, 3)
+
+	if len(prefix) != 0 {
+		parts = append(parts, mongoIndexKeysName(prefix))
+	}
+
+	parts = append(parts, "text("+strings.Join(texts, ",")+")")
+
+	if len(suffix) != 0 {
+		parts = append(parts, mongoIndexKeysName(suffix))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// MongoIndexReport the report of the index synchronization, the indexes are named as "db.collection.index".
+type MongoIndexReport struct {
+	// DryRun the changes are not applied
+	DryRun bool
+
+	Created []string
+
+	// Dropped the undeclared ones, only with `WithMongoIndexDrop`
+	Dropped []string
+
+	// Conflicts the existing ones which have the same names or keys but different keys, unique, TTL,
+	// partial filters or collations, they are recreated only with `WithMongoIndexDrop`
+	Conflicts []string
+}
+
+type mongoIndexSetting struct {
+	indexes []*MongoIndex
+	drop    bool
+	dryRun  bool
+}
+
+// MongoIndexOption configures how we synchronize the mongo indexes.
+type MongoIndexOption func(s *mongoIndexSetting)
+
+// WithMongoIndexDrop specifies dropping the undeclared indexes of the declared collections (except _id_),
+// and recreating the conflicting ones.
+func WithMongoIndexDrop() MongoIndexOption {
+	return func(s *mongoIndexSetting) {
+		s.drop = true
+	}
+}
+
+// WithMongoIndexDryRun specifies only reporting the changes without applying them.
+func WithMongoIndexDryRun() MongoIndexOption {
+	return func(s *mongoIndexSetting) {
+		s.dryRun = true
+	}
+}
+
+// WithMongoIndexes registers the indexes which are synchronized during `Init`: the missing ones are created,
+// and the report is logged.
+func WithMongoIndexes(indexes []*MongoIndex, options ...MongoIndexOption) MongoOption {
+	return func(s *mongoSetting) {
+		s.indexes = &mongoIndexSetting{indexes: indexes}
+
+		for _, f := range options {
+			f(s.indexes)
+		}
+	}
+}
+
+// MongoSyncIndexes synchronizes the declared indexes of the named mongodb,
+// eg: report the drift with `WithMongoIndexDryRun` in CI.
+func MongoSyncIndexes(ctx context.Context, name string, indexes []*MongoIndex, options ...MongoIndexOption) (*MongoIndexReport, error) {
+	setting := &mongoIndexSetting{indexes: indexes}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	return syncMongoIndexes(ctx, Mongo(name), setting)
+}
+
+// mongoExistingIndex the index returned by listIndexes
+type mongoExistingIndex struct {
+	Name               string      `bson:"name"`
+	Key                bson.D      `bson:"key"`
+	Unique             bool        `bson:"unique"`
+	ExpireAfterSeconds interface{} `bson:"expireAfterSeconds"`
+	PartialFilter      bson.Raw    `bson:"partialFilterExpression"`
+	Collation          bson.Raw    `bson:"collation"`
+
+	// Weights the text fields of a text index
+	Weights bson.D `bson:"weights"`
+}
+
+func (e *mongoExistingIndex) keySpec() string {
+	return mongoIndexKeySpec(e.Key, e.Weights)
+}
+
+func (e *mongoExistingIndex) ttl() time.Duration {
+	switch v := e.ExpireAfterSeconds.(type) {
+	case int32:
+		return time.Duration(v) * time.Second
+	case int64:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v) * time.Second
+	}
+
+	return 0
+}
+
+// match reports whether the existing index is the same as the declared one (except the name).
+func (e *mongoExistingIndex) match(i *MongoIndex) bool {
+	if e.keySpec() != mongoIndexKeySpec(i.Keys, nil) || e.Unique != i.Unique || e.ttl() != i.TTL.Truncate(time.Second) {
+		return false
+	}
+
+	return e.matchPartialFilter(i.PartialFilter) && e.matchCollation(i.Collation)
+}
+
+func (e *mongoExistingIndex) matchPartialFilter(filter interface{}) bool {
+	if filter == nil {
+		return len(e.PartialFilter) == 0
+	}
+
+	if len(e.PartialFilter) == 0 {
+		return false
+	}
+
+	b, err := bson.Marshal(filter)
+
+	if err != nil {
+		return false
+	}
+
+	// compare as maps since the fields of bson.M are unordered
+	declared := bson.M{}
+	existing := bson.M{}
+
+	if err = bson.Unmarshal(b, &declared); err != nil {
+		return false
+	}
+
+	if err = bson.Unmarshal(e.PartialFilter, &existing); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(declared, existing)
+}
+
+// matchCollation compares the declared fields only, since the server fills the others with the defaults of the locale.
+func (e *mongoExistingIndex) matchCollation(collation *options.Collation) bool {
+	if collation == nil {
+		return len(e.Collation) == 0
+	}
+
+	if len(e.Collation) == 0 {
+		return false
+	}
+
+	elems, err := collation.ToDocument().Elements()
+
+	if err != nil {
+		return false
+	}
+
+	for _, v := range elems {
+		value, err := e.Collation.LookupErr(v.Key())
+
+		if err != nil || !value.Equal(v.Value()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func syncMongoIndexes(ctx context.Context, client *mongo.Client, setting *mongoIndexSetting) (*MongoIndexReport, error) {
+	report := &MongoIndexReport{DryRun: setting.dryRun}
+
+	// group by collection and keep the declaration order
+	groups := make(map[string][]*MongoIndex)
+	namespaces := make([]string, 0)
+
+	for _, v := range setting.indexes {
+		ns := v.namespace()
+
+		if _, ok := groups[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+
+		groups[ns] = append(groups[ns], v)
+	}
+
+	for _, ns := range namespaces {
+		declared := groups[ns]
+
+		view := client.Database(declared[0].Database).Collection(declared[0].Collection).Indexes()
+
+		existing, err := listMongoIndexes(ctx, view)
+
+		if err != nil {
+			return nil, fmt.Errorf("list indexes of %s: %w", ns, err)
+		}
+
+		diff := diffMongoIndexes(declared, existing, setting.drop)
+
+		for _, v := range diff.conflicts {
+			report.Conflicts = append(report.Conflicts, ns+"."+v)
+		}
+
+		for _, v := range diff.drop {
+			report.Dropped = append(report.Dropped, ns+"."+v)
+		}
+
+		for _, v := range diff.create {
+			report.Created = append(report.Created, ns+"."+v.name())
+		}
+
+		if setting.dryRun {
+			continue
+		}
+
+		for _, v := range diff.drop {
+			if _, err = view.DropOne(ctx, v); err != nil {
+				return nil, fmt.Errorf("drop index %s.%s: %w", ns, v, err)
+			}
+		}
+
+		if len(diff.create) != 0 {
+			models := make([]mongo.IndexModel, 0, len(diff.create))
+
+			for _, v := range diff.create {
+				models = append(models, v.model())
+			}
+
+			if _, err = view.CreateMany(ctx, models); err != nil {
+				return nil, fmt.Errorf("create indexes of %s: %w", ns, err)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func listMongoIndexes(ctx context.Context, view mongo.IndexView) ([]*mongoExistingIndex, error) {
+	cursor, err := view.List(ctx)
+
+	if err != nil {
+		// NamespaceNotFound, the collection doesn't exist
+		var e mongo.CommandError
+
+		if errors.As(err, &e) && e.Code == 26 {
+			return []*mongoExistingIndex{}, nil
+		}
+
+		return nil, err
+	}
+
+	existing := make([]*mongoExistingIndex, 0)
+
+	if err = cursor.All(ctx, &existing); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+type mongoIndexDiff struct {
+	create    []*MongoIndex
+	drop      []string
+	conflicts []string
+}
+
+// diffMongoIndexes compares the declared indexes with the existing ones, which are matched by names,
+// or by keys if none has the declared name, so that an index renamed by hand isn't created again.
+func diffMongoIndexes(declared []*MongoIndex, existing []*mongoExistingIndex, drop bool) *mongoIndexDiff {
+	diff := new(mongoIndexDiff)
+
+	existingMap := make(map[string]*mongoExistingIndex, len(existing))
+
+	for _, v := range existing {
+		existingMap[v.Name] = v
+	}
+
+	// the matched existing index of each declared one, by names first
+	matched := make([]*mongoExistingIndex, len(declared))
+	claimed := make(map[string]bool, len(declared))
+
+	for i, v := range declared {
+		if e, ok := existingMap[v.name()]; ok {
+			matched[i] = e
+			claimed[e.Name] = true
+		}
+	}
+
+	for i, v := range declared {
+		if matched[i] != nil {
+			continue
+		}
+
+		keys := mongoIndexKeySpec(v.Keys, nil)
+
+		for _, e := range existing {
+			if !claimed[e.Name] && e.keySpec() == keys {
+				matched[i] = e
+				claimed[e.Name] = true
+
+				break
+			}
+		}
+	}
+
+	for i, v := range declared {
+		e := matched[i]
+
+		if e == nil {
+			diff.create = append(diff.create, v)
+
+			continue
+		}
+
+		if e.match(v) {
+			continue
+		}
+
+		diff.conflicts = append(diff.conflicts, e.Name)
+
+		if drop {
+			diff.drop = append(diff.drop, e.Name)
+			diff.create = append(diff.create, v)
+		}
+	}
+
+	if drop {
+		undeclared := make([]string, 0)
+
+		for _, v := range existing {
+			if v.Name != "_id_" && !claimed[v.Name] {
+				undeclared = append(undeclared, v.Name)
+			}
+		}
+
+		sort.Strings(undeclared)
+
+		diff.drop = append(diff.drop, undeclared...)
+	}
+
+	return diff
+}
+
+func logMongoIndexReport(name string, report *MongoIndexReport) {
+	fields := []zap.Field{
+		zap.String("mongodb", name),
+		zap.Bool("dry_run", report.DryRun),
+		zap.Strings("created", report.Created),
+		zap.Strings("dropped", report.Dropped),
+		zap.Strings("conflicts", report.Conflicts),
+	}
+
+	if len(report.Conflicts) != 0 {
+		logger.Warn("[yiigo] mongo indexes conflict", fields...)
+
+		return
+	}
+
+	logger.Info("[yiigo] mongo indexes synchronized", fields...)
+}
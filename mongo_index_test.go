@@ -0,0 +1,212 @@
+package yiigo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMongoIndexOption(t *testing.T) {
+	indexes := []*MongoIndex{
+		{Database: "test", Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+	}
+
+	setting := new(mongoSetting)
+
+	WithMongoIndexes(indexes, WithMongoIndexDrop(), WithMongoIndexDryRun())(setting)
+
+	assert.Equal(t, &mongoIndexSetting{
+		indexes: indexes,
+		drop:    true,
+		dryRun:  true,
+	}, setting.indexes)
+}
+
+func TestMongoIndexName(t *testing.T) {
+	assert.Equal(t, "uid_1_created_at_-1", (&MongoIndex{Keys: bson.D{{Key: "uid", Value: 1}, {Key: "created_at", Value: -1}}}).name())
+	assert.Equal(t, "title_text", (&MongoIndex{Keys: bson.D{{Key: "title", Value: "text"}}}).name())
+	assert.Equal(t, "uniq_email", (&MongoIndex{Name: "uniq_email", Keys: bson.D{{Key: "email", Value: 1}}}).name())
+
+	// the numbers of the server are int32 or double
+	assert.Equal(t, "uid_1_created_at_-1", mongoIndexKeysName(bson.D{{Key: "uid", Value: int32(1)}, {Key: "created_at", Value: float64(-1)}}))
+}
+
+func TestMongoIndexModel(t *testing.T) {
+	collation := &options.Collation{Locale: "zh"}
+
+	model := (&MongoIndex{
+		Keys:          bson.D{{Key: "session", Value: 1}},
+		Unique:        true,
+		TTL:           time.Hour,
+		PartialFilter: bson.M{"status": "active"},
+		Collation:     collation,
+	}).model()
+
+	assert.Equal(t, bson.D{{Key: "session", Value: 1}}, model.Keys)
+	assert.Equal(t, "session_1", *model.Options.Name)
+	assert.True(t, *model.Options.Unique)
+	assert.Equal(t, int32(3600), *model.Options.ExpireAfterSeconds)
+	assert.Equal(t, bson.M{"status": "active"}, model.Options.PartialFilterExpression)
+	assert.Equal(t, collation, model.Options.Collation)
+}
+
+func TestDiffMongoIndexes(t *testing.T) {
+	declared := []*MongoIndex{
+		{Database: "test", Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		{Database: "test", Collection: "users", Keys: bson.D{{Key: "uid", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Database: "test", Collection: "users", Name: "expire", Keys: bson.D{{Key: "expired_at", Value: 1}}, TTL: time.Hour},
+		{Database: "test", Collection: "users", Keys: bson.D{{Key: "phone", Value: 1}}},
+	}
+
+	existing := []*mongoExistingIndex{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, Unique: true},
+		{Name: "expire", Key: bson.D{{Key: "expired_at", Value: int32(1)}}, ExpireAfterSeconds: int32(60)},
+		{Name: "name_1", Key: bson.D{{Key: "name", Value: int32(1)}}},
+		{Name: "age_1", Key: bson.D{{Key: "age", Value: int32(1)}}},
+	}
+
+	diff := diffMongoIndexes(declared, existing, false)
+
+	assert.Equal(t, []*MongoIndex{declared[1], declared[3]}, diff.create)
+	assert.Nil(t, diff.drop)
+	assert.Equal(t, []string{"expire"}, diff.conflicts)
+
+	diff = diffMongoIndexes(declared, existing, true)
+
+	assert.Equal(t, []*MongoIndex{declared[1], declared[2], declared[3]}, diff.create)
+	assert.Equal(t, []string{"expire", "age_1", "name_1"}, diff.drop)
+	assert.Equal(t, []string{"expire"}, diff.conflicts)
+
+	// up to date
+	diff = diffMongoIndexes(declared[:1], existing[:2], true)
+
+	assert.Nil(t, diff.create)
+	assert.Nil(t, diff.drop)
+	assert.Nil(t, diff.conflicts)
+}
+
+func TestDiffMongoIndexesByKeys(t *testing.T) {
+	declared := []*MongoIndex{
+		{Database: "test", Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		{Database: "test", Collection: "users", Keys: bson.D{{Key: "phone", Value: 1}}, Unique: true},
+	}
+
+	// the same keys under other names
+	existing := []*mongoExistingIndex{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Name: "uniq_email", Key: bson.D{{Key: "email", Value: int32(1)}}, Unique: true},
+		{Name: "idx_phone", Key: bson.D{{Key: "phone", Value: int32(1)}}},
+	}
+
+	diff := diffMongoIndexes(declared, existing, false)
+
+	assert.Nil(t, diff.create)
+	assert.Nil(t, diff.drop)
+	assert.Equal(t, []string{"idx_phone"}, diff.conflicts)
+
+	diff = diffMongoIndexes(declared, existing, true)
+
+	assert.Equal(t, []*MongoIndex{declared[1]}, diff.create)
+	assert.Equal(t, []string{"idx_phone"}, diff.drop)
+	assert.Equal(t, []string{"idx_phone"}, diff.conflicts)
+}
+
+func TestDiffMongoIndexesOptions(t *testing.T) {
+	filter, _ := bson.Marshal(bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 18}}}, {Key: "status", Value: "active"}})
+	collation, _ := bson.Marshal(bson.D{{Key: "locale", Value: "zh"}, {Key: "caseLevel", Value: false}, {Key: "strength", Value: int32(2)}, {Key: "version", Value: "57.1"}})
+
+	existing := []*mongoExistingIndex{
+		{Name: "uid_1", Key: bson.D{{Key: "uid", Value: int32(1)}}, PartialFilter: filter},
+		{Name: "name_1", Key: bson.D{{Key: "name", Value: int32(1)}}, Collation: collation},
+	}
+
+	declared := []*MongoIndex{
+		{Keys: bson.D{{Key: "uid", Value: 1}}, PartialFilter: bson.M{"status": "active", "age": bson.M{"$gt": 18}}},
+		{Keys: bson.D{{Key: "name", Value: 1}}, Collation: &options.Collation{Locale: "zh", Strength: 2}},
+	}
+
+	// up to date, the collation defaults of the server are ignored
+	diff := diffMongoIndexes(declared, existing, false)
+
+	assert.Nil(t, diff.create)
+	assert.Nil(t, diff.conflicts)
+
+	declared = []*MongoIndex{
+		{Keys: bson.D{{Key: "uid", Value: 1}}, PartialFilter: bson.M{"status": "paid", "age": bson.M{"$gt": 18}}},
+		{Keys: bson.D{{Key: "name", Value: 1}}, Collation: &options.Collation{Locale: "zh", Strength: 1}},
+	}
+
+	diff = diffMongoIndexes(declared, existing, false)
+
+	assert.Nil(t, diff.create)
+	assert.Equal(t, []string{"uid_1", "name_1"}, diff.conflicts)
+
+	// removed
+	declared = []*MongoIndex{
+		{Keys: bson.D{{Key: "uid", Value: 1}}},
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+	}
+
+	diff = diffMongoIndexes(declared, existing, true)
+
+	assert.Equal(t, declared, diff.create)
+	assert.Equal(t, []string{"uid_1", "name_1"}, diff.drop)
+	assert.Equal(t, []string{"uid_1", "name_1"}, diff.conflicts)
+}
+
+func TestMongoIndexKeySpec(t *testing.T) {
+	assert.Equal(t, "uid_1_created_at_-1", mongoIndexKeySpec(bson.D{{Key: "uid", Value: 1}, {Key: "created_at", Value: -1}}, nil))
+
+	// declared and stored text indexes
+	assert.Equal(t, "text(content,title)", mongoIndexKeySpec(bson.D{{Key: "title", Value: "text"}, {Key: "content", Value: "text"}}, nil))
+	assert.Equal(t, "text(content,title)", mongoIndexKeySpec(
+		bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+		bson.D{{Key: "content", Value: int32(1)}, {Key: "title", Value: int32(1)}},
+	))
+
+	// compound text indexes
+	assert.Equal(t, "uid_1_text(title)_status_1", mongoIndexKeySpec(bson.D{{Key: "uid", Value: 1}, {Key: "title", Value: "text"}, {Key: "status", Value: 1}}, nil))
+	assert.Equal(t, "uid_1_text(title)_status_1", mongoIndexKeySpec(
+		bson.D{{Key: "uid", Value: int32(1)}, {Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}, {Key: "status", Value: int32(1)}},
+		bson.D{{Key: "title", Value: int32(1)}},
+	))
+}
+
+func TestDiffMongoIndexesText(t *testing.T) {
+	declared := []*MongoIndex{
+		{Database: "test", Collection: "posts", Keys: bson.D{{Key: "title", Value: "text"}, {Key: "content", Value: "text"}}},
+		{Database: "test", Collection: "posts", Name: "search", Keys: bson.D{{Key: "tags", Value: "text"}}},
+	}
+
+	existing := []*mongoExistingIndex{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		{
+			Name:    "title_text_content_text",
+			Key:     bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			Weights: bson.D{{Key: "content", Value: int32(1)}, {Key: "title", Value: int32(1)}},
+		},
+		{
+			Name:    "search",
+			Key:     bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			Weights: bson.D{{Key: "summary", Value: int32(1)}},
+		},
+	}
+
+	diff := diffMongoIndexes(declared, existing, true)
+
+	// the text fields of search are changed
+	assert.Equal(t, []*MongoIndex{declared[1]}, diff.create)
+	assert.Equal(t, []string{"search"}, diff.drop)
+	assert.Equal(t, []string{"search"}, diff.conflicts)
+}
+
+func TestMongoExistingIndexTTL(t *testing.T) {
+	assert.Equal(t, time.Minute, (&mongoExistingIndex{ExpireAfterSeconds: int32(60)}).ttl())
+	assert.Equal(t, time.Minute, (&mongoExistingIndex{ExpireAfterSeconds: int64(60)}).ttl())
+	assert.Equal(t, time.Minute, (&mongoExistingIndex{ExpireAfterSeconds: float64(60)}).ttl())
+	assert.Equal(t, time.Duration(0), (&mongoExistingIndex{}).ttl())
+}
@@ -0,0 +1,250 @@
+package yiigo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.uber.org/zap"
+)
+
+// the max length of the logged commands
+const mongoCommandLogMaxLen = 1024
+
+type mongoCommandLogSetting struct {
+	mongo    string
+	logger   string
+	slow     time.Duration
+	commands sync.Map
+}
+
+type mongoStartedCommand struct {
+	database string
+	command  string
+}
+
+func (s *mongoCommandLogSetting) monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			command := e.Command.String()
+
+			if len(command) > mongoCommandLogMaxLen {
+				command = command[:mongoCommandLogMaxLen] + "..."
+			}
+
+			s.commands.Store(s.key(e.ConnectionID, e.RequestID), &mongoStartedCommand{
+				database: e.DatabaseName,
+				command:  command,
+			})
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			s.log(&e.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			s.log(&e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+func (s *mongoCommandLogSetting) key(connID string, requestID int64) string {
+	return fmt.Sprintf("%s:%d", connID, requestID)
+}
+
+func (s *mongoCommandLogSetting) log(e *event.CommandFinishedEvent, failure string) {
+	duration := time.Duration(e.DurationNanos)
+
+	fields := []zap.Field{
+		zap.String("mongodb", s.mongo),
+		zap.String("command_name", e.CommandName),
+	}
+
+	if v, ok := s.commands.LoadAndDelete(s.key(e.ConnectionID, e.RequestID)); ok {
+		started := v.(*mongoStartedCommand)
+
+		fields = append(fields, zap.String("database", started.database), zap.String("command", started.command))
+	}
+
+	fields = append(fields, zap.String("duration", duration.String()))
+
+	l := Logger(s.logger)
+
+	switch {
+	case len(failure) != 0:
+		l.Error("[yiigo] mongo command error", append(fields, zap.String("error", failure))...)
+	case duration >= s.slow:
+		l.Warn("[yiigo] slow mongo command", fields...)
+	default:
+		l.Debug("[yiigo] mongo command", fields...)
+	}
+}
+
+// MongoPoolStats the stats of a mongo connection pool, the counters are accumulated since the client is connected.
+type MongoPoolStats struct {
+	// Open the number of the open connections
+	Open int64 `json:"open"`
+
+	// InUse the number of the checked out connections
+	InUse int64 `json:"in_use"`
+
+	Created  int64 `json:"created"`
+	Closed   int64 `json:"closed"`
+	Checkout int64 `json:"checkout"`
+
+	// CheckoutFailed the failed checkouts, including CheckoutTimeouts
+	CheckoutFailed int64 `json:"checkout_failed"`
+
+	// CheckoutTimeouts the checkouts which timed out waiting for a connection,
+	// it means the pool is exhausted (consider a larger maxPoolSize).
+	CheckoutTimeouts int64 `json:"checkout_timeouts"`
+
+	// Cleared the number of times the pool is cleared, eg: after network errors
+	Cleared int64 `json:"cleared"`
+
+	// WaitTime the total time of the checkouts waiting for connections, succeeded or failed
+	WaitTime time.Duration `json:"wait_time"`
+
+	// MaxWaitTime the longest wait of the checkouts
+	MaxWaitTime time.Duration `json:"max_wait_time"`
+}
+
+// the pool stats of the mongodb (name => *mongoPoolCounter)
+var mgoPoolStats sync.Map
+
+// mongoCheckOutStarted the event which is emitted before checking out (not defined by the driver)
+const mongoCheckOutStarted = "ConnectionCheckOutStarted"
+
+type mongoPoolCounter struct {
+	created          int64
+	closed           int64
+	checkout         int64
+	checkin          int64
+	checkoutFailed   int64
+	checkoutTimeouts int64
+	cleared          int64
+	waitTime         int64
+	maxWaitTime      int64
+
+	// waiting the start times of the checkouts in progress by the server address,
+	// the events carry no checkout id, so the waits are paired in order (which keeps the total exact).
+	waiting map[string][]time.Time
+	mutex   sync.Mutex
+}
+
+func (c *mongoPoolCounter) monitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case mongoCheckOutStarted:
+				c.checkoutStarted(e.Address)
+			case event.ConnectionCreated:
+				atomic.AddInt64(&c.created, 1)
+			case event.ConnectionClosed:
+				atomic.AddInt64(&c.closed, 1)
+			case event.GetSucceeded:
+				atomic.AddInt64(&c.checkout, 1)
+
+				c.checkoutDone(e.Address)
+			case event.ConnectionReturned:
+				atomic.AddInt64(&c.checkin, 1)
+			case event.GetFailed:
+				atomic.AddInt64(&c.checkoutFailed, 1)
+
+				if e.Reason == event.ReasonTimedOut {
+					atomic.AddInt64(&c.checkoutTimeouts, 1)
+				}
+
+				c.checkoutDone(e.Address)
+			case event.PoolCleared:
+				atomic.AddInt64(&c.cleared, 1)
+			case event.PoolClosedEvent:
+				// the checkouts of a closed pool may never be done
+				c.mutex.Lock()
+				delete(c.waiting, e.Address)
+				c.mutex.Unlock()
+			}
+		},
+	}
+}
+
+func (c *mongoPoolCounter) checkoutStarted(addr string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.waiting == nil {
+		c.waiting = make(map[string][]time.Time)
+	}
+
+	c.waiting[addr] = append(c.waiting[addr], time.Now())
+}
+
+func (c *mongoPoolCounter) checkoutDone(addr string) {
+	c.mutex.Lock()
+
+	starts := c.waiting[addr]
+
+	if len(starts) == 0 {
+		c.mutex.Unlock()
+
+		return
+	}
+
+	start := starts[0]
+
+	if len(starts) == 1 {
+		delete(c.waiting, addr)
+	} else {
+		c.waiting[addr] = starts[1:]
+	}
+
+	c.mutex.Unlock()
+
+	wait := int64(time.Since(start))
+
+	atomic.AddInt64(&c.waitTime, wait)
+
+	for {
+		max := atomic.LoadInt64(&c.maxWaitTime)
+
+		if wait <= max || atomic.CompareAndSwapInt64(&c.maxWaitTime, max, wait) {
+			return
+		}
+	}
+}
+
+func (c *mongoPoolCounter) stats() *MongoPoolStats {
+	stats := &MongoPoolStats{
+		Created:          atomic.LoadInt64(&c.created),
+		Closed:           atomic.LoadInt64(&c.closed),
+		Checkout:         atomic.LoadInt64(&c.checkout),
+		CheckoutFailed:   atomic.LoadInt64(&c.checkoutFailed),
+		CheckoutTimeouts: atomic.LoadInt64(&c.checkoutTimeouts),
+		Cleared:          atomic.LoadInt64(&c.cleared),
+		WaitTime:         time.Duration(atomic.LoadInt64(&c.waitTime)),
+		MaxWaitTime:      time.Duration(atomic.LoadInt64(&c.maxWaitTime)),
+	}
+
+	stats.Open = stats.Created - stats.Closed
+	stats.InUse = stats.Checkout - atomic.LoadInt64(&c.checkin)
+
+	return stats
+}
+
+// MongoPoolStat returns the pool stats of the mongodb, it's nil if the mongodb doesn't enable `WithMongoPoolMonitor`.
+func MongoPoolStat(name ...string) *MongoPoolStats {
+	key := Default
+
+	if len(name) != 0 {
+		key = name[0]
+	}
+
+	v, ok := mgoPoolStats.Load(key)
+
+	if !ok {
+		return nil
+	}
+
+	return v.(*mongoPoolCounter).stats()
+}
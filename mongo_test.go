@@ -0,0 +1,203 @@
+package yiigo
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestMongoOption(t *testing.T) {
+	setting := new(mongoSetting)
+
+	registry := bson.NewRegistryBuilder().Build()
+
+	options := []MongoOption{
+		WithMongoAppName("demo"),
+		WithMongoRegistry(registry),
+		WithMongoTLSFiles("client.pem", "client.key", "ca.pem"),
+		WithMongoCommandLogger("mongo", time.Second),
+		WithMongoPoolMonitor(),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &mongoSetting{
+		appName:  "demo",
+		registry: registry,
+		tls: &mongoTLSSetting{
+			certFile: "client.pem",
+			keyFile:  "client.key",
+			caFile:   "ca.pem",
+		},
+		commandLog: &mongoCommandLogSetting{
+			logger: "mongo",
+			slow:   time.Second,
+		},
+		poolStats: true,
+	}, setting)
+}
+
+func TestMongoClientOptions(t *testing.T) {
+	registry := bson.NewRegistryBuilder().Build()
+
+	setting := &mongoSetting{
+		appName:  "demo",
+		registry: registry,
+		commandLog: &mongoCommandLogSetting{
+			logger: "mongo",
+			slow:   time.Second,
+		},
+		poolStats: true,
+	}
+
+	opts, err := mongoClientOptions("options", "mongodb://localhost:27017/?appName=dsn", setting)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "demo", *opts.AppName)
+	assert.Equal(t, registry, opts.Registry)
+	assert.NotNil(t, opts.Monitor)
+	assert.NotNil(t, opts.PoolMonitor)
+	assert.Equal(t, "options", setting.commandLog.mongo)
+
+	// registered after the client is connected
+	assert.NotNil(t, setting.poolCounter)
+	assert.Nil(t, MongoPoolStat("options"))
+
+	// tls files
+	dir := t.TempDir()
+
+	ca := filepath.Join(dir, "ca.pem")
+
+	assert.Nil(t, ioutil.WriteFile(ca, []byte("invalid"), 0644))
+
+	_, err = mongoClientOptions("tls", "mongodb://localhost:27017", &mongoSetting{tls: &mongoTLSSetting{caFile: ca}})
+
+	assert.NotNil(t, err)
+
+	_, err = mongoClientOptions("tls", "mongodb://localhost:27017", &mongoSetting{tls: &mongoTLSSetting{certFile: filepath.Join(dir, "client.pem"), keyFile: filepath.Join(dir, "client.key")}})
+
+	assert.NotNil(t, err)
+
+	opts, err = mongoClientOptions("tls", "mongodb://localhost:27017", &mongoSetting{tls: new(mongoTLSSetting)})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, opts.TLSConfig)
+}
+
+func TestMongoCommandLog(t *testing.T) {
+	setting := &mongoCommandLogSetting{
+		mongo:  "default",
+		logger: "mongo",
+		slow:   100 * time.Millisecond,
+	}
+
+	monitor := setting.monitor()
+
+	ctx := context.Background()
+
+	cmd, _ := bson.Marshal(bson.M{"find": "users", "filter": bson.M{"age": bson.M{"$gt": 18}}})
+
+	monitor.Started(ctx, &event.CommandStartedEvent{
+		Command:      cmd,
+		DatabaseName: "test",
+		CommandName:  "find",
+		RequestID:    1,
+		ConnectionID: "localhost:27017[-1]",
+	})
+
+	v, ok := setting.commands.Load(setting.key("localhost:27017[-1]", 1))
+
+	assert.True(t, ok)
+	assert.Equal(t, &mongoStartedCommand{database: "test", command: bson.Raw(cmd).String()}, v)
+
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{
+			DurationNanos: int64(200 * time.Millisecond),
+			CommandName:   "find",
+			RequestID:     1,
+			ConnectionID:  "localhost:27017[-1]",
+		},
+	})
+
+	_, ok = setting.commands.Load(setting.key("localhost:27017[-1]", 1))
+
+	assert.False(t, ok)
+}
+
+func TestMongoPoolCounter(t *testing.T) {
+	counter := new(mongoPoolCounter)
+
+	monitor := counter.monitor()
+
+	addr := "localhost:27017"
+
+	for _, e := range []*event.PoolEvent{
+		{Type: mongoCheckOutStarted, Address: addr},
+		{Type: mongoCheckOutStarted, Address: addr},
+		{Type: mongoCheckOutStarted, Address: addr},
+		{Type: mongoCheckOutStarted, Address: addr},
+		{Type: event.ConnectionCreated, Address: addr},
+		{Type: event.ConnectionCreated, Address: addr},
+		{Type: event.ConnectionReady, Address: addr},
+		{Type: event.GetSucceeded, Address: addr},
+		{Type: event.GetSucceeded, Address: addr},
+		{Type: event.ConnectionReturned, Address: addr},
+		{Type: event.GetFailed, Address: addr, Reason: event.ReasonTimedOut},
+		{Type: event.GetFailed, Address: addr, Reason: event.ReasonConnectionErrored},
+		{Type: event.ConnectionClosed, Address: addr},
+		{Type: event.PoolCleared, Address: addr},
+	} {
+		monitor.Event(e)
+	}
+
+	stats := counter.stats()
+
+	assert.Equal(t, &MongoPoolStats{
+		Open:             1,
+		InUse:            1,
+		Created:          2,
+		Closed:           1,
+		Checkout:         2,
+		CheckoutFailed:   2,
+		CheckoutTimeouts: 1,
+		Cleared:          1,
+		WaitTime:         stats.WaitTime,
+		MaxWaitTime:      stats.MaxWaitTime,
+	}, stats)
+
+	assert.Empty(t, counter.waiting)
+
+	// wait from the checkout started to done
+	monitor.Event(&event.PoolEvent{Type: mongoCheckOutStarted, Address: addr})
+
+	time.Sleep(20 * time.Millisecond)
+
+	monitor.Event(&event.PoolEvent{Type: event.GetSucceeded, Address: addr})
+
+	stats = counter.stats()
+
+	assert.GreaterOrEqual(t, int64(stats.WaitTime), int64(20*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(stats.MaxWaitTime), int64(20*time.Millisecond))
+	assert.LessOrEqual(t, int64(stats.MaxWaitTime), int64(stats.WaitTime))
+
+	// the checkouts of the closed pool are dropped
+	monitor.Event(&event.PoolEvent{Type: mongoCheckOutStarted, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.PoolClosedEvent, Address: addr})
+
+	assert.Empty(t, counter.waiting)
+}
+
+func TestMongoPoolStatsNotConnected(t *testing.T) {
+	err := initMongoDB("unreachable", "mongodb://127.0.0.1:1/?connectTimeoutMS=100&serverSelectionTimeoutMS=100", WithMongoPoolMonitor())
+
+	assert.NotNil(t, err)
+	assert.Nil(t, MongoPoolStat("unreachable"))
+}
@@ -0,0 +1,211 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.uber.org/zap"
+)
+
+// the error labels of the retryable transactions
+const (
+	mongoTransientTxError      = "TransientTransactionError"
+	mongoUnknownTxCommitResult = "UnknownTransactionCommitResult"
+)
+
+// MongoTxFunc the function of a mongo transaction, the operations must use sc as the context to join the transaction.
+// It may run more than once when the transaction is retried, so it should be idempotent except for the database writes.
+type MongoTxFunc func(sc mongo.SessionContext) error
+
+type mongoTxSetting struct {
+	readConcern  *readconcern.ReadConcern
+	writeConcern *writeconcern.WriteConcern
+	readPref     *readpref.ReadPref
+	retries      int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+}
+
+// MongoTxOption configures how we set up the mongo transaction.
+type MongoTxOption func(s *mongoTxSetting)
+
+// WithMongoTxReadConcern specifies the read concern of the transaction, eg: readconcern.Snapshot().
+func WithMongoTxReadConcern(rc *readconcern.ReadConcern) MongoTxOption {
+	return func(s *mongoTxSetting) {
+		s.readConcern = rc
+	}
+}
+
+// WithMongoTxWriteConcern specifies the write concern of the transaction, eg: writeconcern.New(writeconcern.WMajority()).
+func WithMongoTxWriteConcern(wc *writeconcern.WriteConcern) MongoTxOption {
+	return func(s *mongoTxSetting) {
+		s.writeConcern = wc
+	}
+}
+
+// WithMongoTxReadPreference specifies the read preference of the transaction, it must be primary for now.
+func WithMongoTxReadPreference(rp *readpref.ReadPref) MongoTxOption {
+	return func(s *mongoTxSetting) {
+		s.readPref = rp
+	}
+}
+
+// WithMongoTxRetry specifies the retries of the transaction and the commit,
+// the delay starts with min and doubles each retry up to max, default is 3 retries with 10ms ~ 1s.
+func WithMongoTxRetry(retries int, min, max time.Duration) MongoTxOption {
+	return func(s *mongoTxSetting) {
+		s.retries = retries
+		s.minBackoff = min
+		s.maxBackoff = max
+	}
+}
+
+// MongoTransaction runs fn in a transaction of the named mongodb (the replica set or sharded cluster), eg:
+//
+//	err := yiigo.MongoTransaction(ctx, yiigo.Default, func(sc mongo.SessionContext) error {
+//		if _, err := orders.InsertOne(sc, order); err != nil {
+//			return err
+//		}
+//
+//		_, err := stocks.UpdateOne(sc, bson.M{"_id": order.SKU}, bson.M{"$inc": bson.M{"count": -1}})
+//
+//		return err
+//	})
+//
+// The whole transaction is retried when it fails with the TransientTransactionError label,
+// and the commit is retried when it fails with the UnknownTransactionCommitResult label.
+func MongoTransaction(ctx context.Context, name string, fn MongoTxFunc, options ...MongoTxOption) error {
+	setting := &mongoTxSetting{
+		retries:    3,
+		minBackoff: 10 * time.Millisecond,
+		maxBackoff: time.Second,
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	sess, err := Mongo(name).StartSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer sess.EndSession(context.Background())
+
+	txOpts := setting.txOptions()
+
+	for i := 0; ; i++ {
+		err = mongo.WithSession(ctx, sess, func(sc mongo.SessionContext) error {
+			return runMongoTx(sc, sess, fn, txOpts, setting)
+		})
+
+		if err == nil || !mongoErrorHasLabel(err, mongoTransientTxError) || i >= setting.retries {
+			return err
+		}
+
+		logger.Warn("[yiigo] mongo transaction retry", zap.String("mongodb", name), zap.Int("attempt", i+1), zap.Error(err))
+
+		if err = setting.wait(ctx, i); err != nil {
+			return err
+		}
+	}
+}
+
+func runMongoTx(sc mongo.SessionContext, sess mongo.Session, fn MongoTxFunc, txOpts *options.TransactionOptions, setting *mongoTxSetting) error {
+	if err := sess.StartTransaction(txOpts); err != nil {
+		return err
+	}
+
+	if err := fn(sc); err != nil {
+		// the context of fn may be canceled, abort with a new one
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		sess.AbortTransaction(ctx)
+
+		return err
+	}
+
+	for i := 0; ; i++ {
+		err := sess.CommitTransaction(sc)
+
+		if err == nil || sc.Err() != nil || !mongoErrorHasLabel(err, mongoUnknownTxCommitResult) || i >= setting.retries {
+			return err
+		}
+
+		if err = setting.wait(sc, i); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *mongoTxSetting) txOptions() *options.TransactionOptions {
+	opts := options.Transaction()
+
+	if s.readConcern != nil {
+		opts.SetReadConcern(s.readConcern)
+	}
+
+	if s.writeConcern != nil {
+		opts.SetWriteConcern(s.writeConcern)
+	}
+
+	if s.readPref != nil {
+		opts.SetReadPreference(s.readPref)
+	}
+
+	return opts
+}
+
+// delay returns the jittered delay of the nth retry.
+func (s *mongoTxSetting) delay(n int) time.Duration {
+	d := s.minBackoff
+
+	for i := 0; i < n && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > s.maxBackoff {
+		d = s.maxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	// [d/2, d]
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (s *mongoTxSetting) wait(ctx context.Context, n int) error {
+	timer := time.NewTimer(s.delay(n))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// mongoErrorHasLabel reports whether the error (or the wrapped one) has the label.
+func mongoErrorHasLabel(err error, label string) bool {
+	var le interface {
+		HasErrorLabel(string) bool
+	}
+
+	if errors.As(err, &le) {
+		return le.HasErrorLabel(label)
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package yiigo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+func TestMongoTxOption(t *testing.T) {
+	setting := new(mongoTxSetting)
+
+	rc := readconcern.Snapshot()
+	wc := writeconcern.New(writeconcern.WMajority())
+	rp := readpref.Primary()
+
+	options := []MongoTxOption{
+		WithMongoTxReadConcern(rc),
+		WithMongoTxWriteConcern(wc),
+		WithMongoTxReadPreference(rp),
+		WithMongoTxRetry(5, 20*time.Millisecond, 2*time.Second),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &mongoTxSetting{
+		readConcern:  rc,
+		writeConcern: wc,
+		readPref:     rp,
+		retries:      5,
+		minBackoff:   20 * time.Millisecond,
+		maxBackoff:   2 * time.Second,
+	}, setting)
+
+	txOpts := setting.txOptions()
+
+	assert.Equal(t, rc, txOpts.ReadConcern)
+	assert.Equal(t, wc, txOpts.WriteConcern)
+	assert.Equal(t, rp, txOpts.ReadPreference)
+}
+
+func TestMongoTxDelay(t *testing.T) {
+	setting := &mongoTxSetting{
+		minBackoff: 10 * time.Millisecond,
+		maxBackoff: 50 * time.Millisecond,
+	}
+
+	for n, max := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond} {
+		d := setting.delay(n)
+
+		assert.True(t, d >= max/2 && d <= max, "retry %d: %s", n, d)
+	}
+}
+
+func TestMongoErrorHasLabel(t *testing.T) {
+	err := mongo.CommandError{
+		Code:   112,
+		Name:   "WriteConflict",
+		Labels: []string{mongoTransientTxError},
+	}
+
+	assert.True(t, mongoErrorHasLabel(err, mongoTransientTxError))
+	assert.False(t, mongoErrorHasLabel(err, mongoUnknownTxCommitResult))
+
+	// wrapped
+	assert.True(t, mongoErrorHasLabel(fmt.Errorf("insert order: %w", err), mongoTransientTxError))
+
+	assert.False(t, mongoErrorHasLabel(fmt.Errorf("insert order"), mongoTransientTxError))
+}
@@ -0,0 +1,402 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// MongoChangeEvent the event of a change stream.
+type MongoChangeEvent struct {
+	// ID the resume token of the event
+	ID            bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	Namespace     struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey       bson.Raw            `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument"`
+	UpdateDescription bson.Raw            `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+
+	// Raw the raw event document
+	Raw bson.Raw `bson:"-"`
+}
+
+// MongoChangeHandler handles the events of `MongoWatch`.
+type MongoChangeHandler func(ctx context.Context, event *MongoChangeEvent) error
+
+// MongoResumeTokenStore persists the resume tokens of the change streams.
+type MongoResumeTokenStore interface {
+	// Load returns the saved token of the key, it's nil if not found.
+	Load(ctx context.Context, key string) (bson.Raw, error)
+
+	// Save saves the token of the key.
+	Save(ctx context.Context, key string, token bson.Raw) error
+}
+
+type fileResumeTokenStore struct {
+	dir string
+}
+
+// NewFileResumeTokenStore returns a store which saves the tokens as files in dir.
+func NewFileResumeTokenStore(dir string) MongoResumeTokenStore {
+	return &fileResumeTokenStore{dir: filepath.Clean(dir)}
+}
+
+func (s *fileResumeTokenStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return bson.Raw(b), nil
+}
+
+func (s *fileResumeTokenStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	// write a temp file and rename, so that the token is never half written
+	f, err := ioutil.TempFile(s.dir, ".token-*")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(token); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *fileResumeTokenStore) path(key string) string {
+	return filepath.Join(s.dir, strings.ReplaceAll(key, string(filepath.Separator), "_")+".token")
+}
+
+type mongoResumeTokenStore struct {
+	name       string
+	database   string
+	collection string
+}
+
+// NewMongoResumeTokenStore returns a store which saves the tokens in the collection of the named mongodb,
+// as documents: {_id: key, token: token, updated_at: time}.
+func NewMongoResumeTokenStore(name, database, collection string) MongoResumeTokenStore {
+	return &mongoResumeTokenStore{
+		name:       name,
+		database:   database,
+		collection: collection,
+	}
+}
+
+func (s *mongoResumeTokenStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	doc := struct {
+		Token bson.Raw `bson:"token"`
+	}{}
+
+	if err := s.coll().FindOne(ctx, bson.M{"_id": key}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return doc.Token, nil
+}
+
+func (s *mongoResumeTokenStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	_, err := s.coll().UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"token": token, "updated_at": time.Now()}}, options.Update().SetUpsert(true))
+
+	return err
+}
+
+func (s *mongoResumeTokenStore) coll() *mongo.Collection {
+	return Mongo(s.name).Database(s.database).Collection(s.collection)
+}
+
+type redisResumeTokenStore struct {
+	client *RedisClient
+	prefix string
+}
+
+// NewRedisResumeTokenStore returns a store which saves the tokens in the named redis, the keys are prefixed by "mongo:resume:".
+func NewRedisResumeTokenStore(name string) MongoResumeTokenStore {
+	return &redisResumeTokenStore{
+		client: NewRedisClient(Redis(name)),
+		prefix: "mongo:resume:",
+	}
+}
+
+func (s *redisResumeTokenStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	b, err := s.client.GetBytes(ctx, s.prefix+key)
+
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return bson.Raw(b), nil
+}
+
+func (s *redisResumeTokenStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	return s.client.Set(ctx, s.prefix+key, []byte(token), 0)
+}
+
+type mongoWatchSetting struct {
+	store        MongoResumeTokenStore
+	key          string
+	fullDocument bool
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+}
+
+// MongoWatchOption configures how we set up the change stream watcher.
+type MongoWatchOption func(s *mongoWatchSetting)
+
+// WithMongoWatchStore specifies the store of the resume tokens, without it the watcher resumes only in the process.
+func WithMongoWatchStore(store MongoResumeTokenStore) MongoWatchOption {
+	return func(s *mongoWatchSetting) {
+		s.store = store
+	}
+}
+
+// WithMongoWatchKey specifies the key of the resume token in the store, default is "<db>.<collection>".
+func WithMongoWatchKey(key string) MongoWatchOption {
+	return func(s *mongoWatchSetting) {
+		s.key = key
+	}
+}
+
+// WithMongoWatchFullDocument specifies looking up the current full documents for the update events.
+func WithMongoWatchFullDocument() MongoWatchOption {
+	return func(s *mongoWatchSetting) {
+		s.fullDocument = true
+	}
+}
+
+// WithMongoWatchBackoff specifies the backoff for rewatching after errors,
+// the delay starts with min and doubles each time up to max, default is 100ms ~ 10s.
+func WithMongoWatchBackoff(min, max time.Duration) MongoWatchOption {
+	return func(s *mongoWatchSetting) {
+		s.minBackoff = min
+		s.maxBackoff = max
+	}
+}
+
+// ErrMongoWatchInvalidated is returned by `MongoWatch` when the change stream is invalidated,
+// eg: the collection is dropped or renamed.
+var ErrMongoWatchInvalidated = errors.New("yiigo: mongo change stream invalidated")
+
+// MongoWatch follows the change stream of the collection of the named mongodb (the replica set or sharded cluster),
+// it blocks until ctx is done and returns nil.
+// The resume token is saved when the stream opens and after each event is handled,
+// and the stream resumes from the saved token after errors or restarts.
+// If handler returns an error or panics (recovered and logged), the event is redelivered after backoff.
+// It returns `ErrMongoWatchInvalidated` on the invalidate event, or the server error if the stream can't resume
+// (eg: ChangeStreamHistoryLost, the token has fallen off the oplog), these are not retried.
+func MongoWatch(ctx context.Context, name, db, coll string, pipeline interface{}, handler MongoChangeHandler, options ...MongoWatchOption) error {
+	setting := &mongoWatchSetting{
+		key:        db + "." + coll,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	w := &mongoWatcher{
+		coll:     Mongo(name).Database(db).Collection(coll),
+		pipeline: pipeline,
+		handler:  handler,
+		setting:  setting,
+	}
+
+	backoff := setting.minBackoff
+
+	for {
+		progressed, err := w.watch(ctx)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if isMongoWatchFatal(err) {
+			logger.Error("[yiigo] mongo watch stopped", zap.String("mongodb", name), zap.String("key", setting.key), zap.Error(err))
+
+			return err
+		}
+
+		if progressed {
+			backoff = setting.minBackoff
+		}
+
+		logger.Error("[yiigo] mongo watch error", zap.String("mongodb", name), zap.String("key", setting.key), zap.Error(err), zap.Duration("retry_after", backoff))
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > setting.maxBackoff {
+			backoff = setting.maxBackoff
+		}
+	}
+}
+
+type mongoWatcher struct {
+	coll     *mongo.Collection
+	pipeline interface{}
+	handler  MongoChangeHandler
+	setting  *mongoWatchSetting
+
+	// token the token of the last handled event
+	token bson.Raw
+}
+
+// watch follows the stream until an error occurs or ctx is done, progressed reports whether any event has been handled.
+func (w *mongoWatcher) watch(ctx context.Context) (progressed bool, err error) {
+	if w.token == nil && w.setting.store != nil {
+		if w.token, err = w.setting.store.Load(ctx, w.setting.key); err != nil {
+			return false, fmt.Errorf("load resume token: %w", err)
+		}
+	}
+
+	opts := options.ChangeStream()
+
+	if w.token != nil {
+		opts.SetResumeAfter(w.token)
+	}
+
+	if w.setting.fullDocument {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
+
+	stream, err := w.coll.Watch(ctx, w.pipeline, opts)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer stream.Close(context.Background())
+
+	// keep the position where the stream opens (the post batch resume token),
+	// so that the events after it are redelivered if the first one fails.
+	if w.token == nil && stream.ResumeToken() != nil {
+		if err = w.save(ctx, stream.ResumeToken()); err != nil {
+			return false, err
+		}
+	}
+
+	for stream.Next(ctx) {
+		event := new(MongoChangeEvent)
+
+		if err = stream.Decode(event); err != nil {
+			return progressed, err
+		}
+
+		if event.OperationType == "invalidate" {
+			return progressed, ErrMongoWatchInvalidated
+		}
+
+		event.Raw = stream.Current
+
+		if err = handleMongoChange(ctx, w.handler, event); err != nil {
+			return progressed, err
+		}
+
+		progressed = true
+
+		if err = w.save(ctx, stream.ResumeToken()); err != nil {
+			return progressed, err
+		}
+	}
+
+	return progressed, stream.Err()
+}
+
+func (w *mongoWatcher) save(ctx context.Context, token bson.Raw) error {
+	w.token = token
+
+	if w.setting.store == nil {
+		return nil
+	}
+
+	if err := w.setting.store.Save(ctx, w.setting.key, token); err != nil {
+		return fmt.Errorf("save resume token: %w", err)
+	}
+
+	return nil
+}
+
+// isMongoWatchFatal reports whether the stream can't be resumed:
+// invalidated, ChangeStreamFatalError (280) or ChangeStreamHistoryLost (286).
+func isMongoWatchFatal(err error) bool {
+	if errors.Is(err, ErrMongoWatchInvalidated) {
+		return true
+	}
+
+	var e mongo.ServerError
+
+	if errors.As(err, &e) {
+		return e.HasErrorCode(280) || e.HasErrorCode(286)
+	}
+
+	return false
+}
+
+func handleMongoChange(ctx context.Context, handler MongoChangeHandler, event *MongoChangeEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("yiigo: mongo watch handler panic: %v", r)
+
+			logger.Error("[yiigo] mongo watch handler panic", zap.Any("error", r), zap.String("operation", event.OperationType), zap.ByteString("stack", debug.Stack()))
+		}
+	}()
+
+	return handler(ctx, event)
+}
@@ -0,0 +1,112 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMongoWatchOption(t *testing.T) {
+	setting := new(mongoWatchSetting)
+
+	store := NewFileResumeTokenStore("tokens")
+
+	options := []MongoWatchOption{
+		WithMongoWatchStore(store),
+		WithMongoWatchKey("search.users"),
+		WithMongoWatchFullDocument(),
+		WithMongoWatchBackoff(time.Second, time.Minute),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &mongoWatchSetting{
+		store:        store,
+		key:          "search.users",
+		fullDocument: true,
+		minBackoff:   time.Second,
+		maxBackoff:   time.Minute,
+	}, setting)
+}
+
+func testResumeTokenStore(t *testing.T, store MongoResumeTokenStore) {
+	ctx := context.Background()
+
+	token, err := store.Load(ctx, "test.users")
+
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+
+	b, _ := bson.Marshal(bson.M{"_data": "826180A7D5000000012B"})
+
+	assert.Nil(t, store.Save(ctx, "test.users", b))
+
+	token, err = store.Load(ctx, "test.users")
+
+	assert.Nil(t, err)
+	assert.Equal(t, bson.Raw(b), token)
+
+	b, _ = bson.Marshal(bson.M{"_data": "826180A7D6000000012B"})
+
+	assert.Nil(t, store.Save(ctx, "test.users", b))
+
+	token, err = store.Load(ctx, "test.users")
+
+	assert.Nil(t, err)
+	assert.Equal(t, bson.Raw(b), token)
+}
+
+func TestFileResumeTokenStore(t *testing.T) {
+	testResumeTokenStore(t, NewFileResumeTokenStore(t.TempDir()+"/tokens"))
+}
+
+func TestRedisResumeTokenStore(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	redisMap.Store("watch", pool)
+
+	defer redisMap.Delete("watch")
+
+	testResumeTokenStore(t, NewRedisResumeTokenStore("watch"))
+
+	assert.True(t, mr.Exists("mongo:resume:test.users"))
+}
+
+func TestHandleMongoChange(t *testing.T) {
+	ctx := context.Background()
+
+	event := &MongoChangeEvent{OperationType: "insert"}
+
+	assert.Nil(t, handleMongoChange(ctx, func(ctx context.Context, e *MongoChangeEvent) error {
+		return nil
+	}, event))
+
+	errHandle := errors.New("handle error")
+
+	assert.Equal(t, errHandle, handleMongoChange(ctx, func(ctx context.Context, e *MongoChangeEvent) error {
+		return errHandle
+	}, event))
+
+	// the panic is recovered as an error
+	assert.NotNil(t, handleMongoChange(ctx, func(ctx context.Context, e *MongoChangeEvent) error {
+		panic("oops")
+	}, event))
+}
+
+func TestIsMongoWatchFatal(t *testing.T) {
+	assert.True(t, isMongoWatchFatal(ErrMongoWatchInvalidated))
+	assert.True(t, isMongoWatchFatal(mongo.CommandError{Code: 286, Name: "ChangeStreamHistoryLost"}))
+	assert.True(t, isMongoWatchFatal(mongo.CommandError{Code: 280, Name: "ChangeStreamFatalError"}))
+
+	// retried
+	assert.False(t, isMongoWatchFatal(mongo.CommandError{Code: 91, Name: "ShutdownInProgress"}))
+	assert.False(t, isMongoWatchFatal(errors.New("connection reset")))
+	assert.False(t, isMongoWatchFatal(nil))
+}
@@ -1,13 +1,18 @@
 package yiigo
 
 import (
+	"sync"
 	"time"
 
 	"github.com/nsqio/go-nsq"
 	"go.uber.org/zap"
 )
 
-var producer *nsq.Producer
+var (
+	producer  *nsq.Producer
+	consumers []*nsq.Consumer
+	nsqMutex  sync.Mutex
+)
 
 // NSQLogger NSQ logger
 type NSQLogger struct{}
@@ -30,7 +35,9 @@ func initProducer(nsqd string) error {
 
 	p.SetLogger(&NSQLogger{}, nsq.LogLevelError)
 
+	nsqMutex.Lock()
 	producer = p
+	nsqMutex.Unlock()
 
 	return nil
 }
@@ -145,6 +152,10 @@ func setConsumers(lookupd []string, options ...NSQOption) error {
 		nc.SetLogger(&NSQLogger{}, nsq.LogLevelError)
 		nc.AddHandler(c)
 
+		nsqMutex.Lock()
+		consumers = append(consumers, nc)
+		nsqMutex.Unlock()
+
 		if err := nc.ConnectToNSQLookupds(lookupd); err != nil {
 			return err
 		}
@@ -153,20 +164,6 @@ func setConsumers(lookupd []string, options ...NSQOption) error {
 	return nil
 }
 
-func initNSQ(nsqd string, lookupd []string, options ...NSQOption) {
-	// init producer
-	if err := initProducer(nsqd); err != nil {
-		logger.Panic("[yiigo] init nsq error", zap.Error(err))
-	}
-
-	// set consumers
-	if err := setConsumers(lookupd, options...); err != nil {
-		logger.Panic("[yiigo] init nsq error", zap.Error(err))
-	}
-
-	logger.Info("[yiigo] nsq is OK")
-}
-
 // NextAttemptDuration helper for attempt duration.
 func NextAttemptDuration(attempts uint16) time.Duration {
 	var d time.Duration
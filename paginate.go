@@ -0,0 +1,567 @@
+package yiigo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCursor is returned when the cursor is malformed or doesn't match the sort fields.
+var ErrInvalidCursor = errors.New("yiigo: invalid cursor")
+
+// SortField a sort key of the keyset pagination.
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// SortAsc returns an ascending sort field.
+func SortAsc(name string) SortField {
+	return SortField{Name: name}
+}
+
+// SortDesc returns a descending sort field.
+func SortDesc(name string) SortField {
+	return SortField{Name: name, Desc: true}
+}
+
+func (f SortField) String() string {
+	if f.Desc {
+		return "-" + f.Name
+	}
+
+	return f.Name
+}
+
+// PageSource is the interface that fetches the items of the keyset pagination.
+type PageSource interface {
+	// Fetch returns at most limit items which match filter, ordered by sorts and after the sort-key values
+	// (nil for the first page).
+	Fetch(ctx context.Context, filter interface{}, sorts []SortField, after []interface{}, limit int) ([]X, error)
+}
+
+type pageSetting struct {
+	secret []byte
+}
+
+// PageOption configures how we paginate.
+type PageOption func(s *pageSetting)
+
+// WithPageCursorSecret specifies signing the cursors with HMAC-SHA256, the cursors which aren't signed by the secret are invalid.
+func WithPageCursorSecret(secret []byte) PageOption {
+	return func(s *pageSetting) {
+		s.secret = secret
+	}
+}
+
+// Paginate returns a page of the items ordered by sorts, and the cursor of the next page which is empty on the last page.
+// The cursor is the opaque base64 of the sort-key values (as JSON with the value types) of the last item, pass "" for the first page.
+// The sort fields should be non-null, and the last one should be unique (eg: _id or id) so that the order is total.
+// The sort-key values are strings, []byte, bools, numbers (as int64, uint64 or float64), time.Time,
+// primitive.ObjectID, primitive.DateTime or primitive.Timestamp.
+func Paginate(ctx context.Context, source PageSource, filter interface{}, sorts []SortField, pageSize int, cursor string, options ...PageOption) ([]X, string, error) {
+	if len(sorts) == 0 {
+		return nil, "", errors.New("yiigo: paginate without sort fields")
+	}
+
+	if pageSize <= 0 {
+		return nil, "", fmt.Errorf("yiigo: invalid page size %d", pageSize)
+	}
+
+	setting := new(pageSetting)
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	var (
+		after []interface{}
+		err   error
+	)
+
+	if len(cursor) != 0 {
+		if after, err = decodePageCursor(cursor, sorts, setting.secret); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// fetch one more to know whether there is a next page
+	items, err := source.Fetch(ctx, filter, sorts, after, pageSize+1)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(items) <= pageSize {
+		return items, "", nil
+	}
+
+	items = items[:pageSize]
+
+	next, err := encodePageCursor(items[pageSize-1], sorts, setting.secret)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return items, next, nil
+}
+
+type pageCursor struct {
+	Sorts  []string          `json:"s"`
+	Values []pageCursorValue `json:"v"`
+}
+
+// pageCursorValue the sort-key value with its type, eg: {"t": "oid", "v": "616d4b5e..."}
+type pageCursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+func newPageCursorValue(v interface{}) (pageCursorValue, error) {
+	switch x := v.(type) {
+	case string:
+		return pageCursorValue{Type: "string", Value: x}, nil
+	case []byte:
+		return pageCursorValue{Type: "bytes", Value: base64.StdEncoding.EncodeToString(x)}, nil
+	case bool:
+		return pageCursorValue{Type: "bool", Value: strconv.FormatBool(x)}, nil
+	case time.Time:
+		return pageCursorValue{Type: "time", Value: x.Format(time.RFC3339Nano)}, nil
+	case primitive.ObjectID:
+		return pageCursorValue{Type: "oid", Value: x.Hex()}, nil
+	case primitive.DateTime:
+		return pageCursorValue{Type: "date", Value: strconv.FormatInt(int64(x), 10)}, nil
+	case primitive.Timestamp:
+		return pageCursorValue{Type: "ts", Value: strconv.FormatUint(uint64(x.T)<<32|uint64(x.I), 10)}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return pageCursorValue{Type: "int", Value: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return pageCursorValue{Type: "uint", Value: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return pageCursorValue{Type: "float", Value: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, nil
+	}
+
+	return pageCursorValue{}, fmt.Errorf("yiigo: unsupported sort value type %T", v)
+}
+
+func (v pageCursorValue) value() (interface{}, error) {
+	switch v.Type {
+	case "string":
+		return v.Value, nil
+	case "bytes":
+		return base64.StdEncoding.DecodeString(v.Value)
+	case "bool":
+		return strconv.ParseBool(v.Value)
+	case "int":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(v.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(v.Value, 64)
+	case "time":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	case "oid":
+		return primitive.ObjectIDFromHex(v.Value)
+	case "date":
+		ms, err := strconv.ParseInt(v.Value, 10, 64)
+
+		return primitive.DateTime(ms), err
+	case "ts":
+		ts, err := strconv.ParseUint(v.Value, 10, 64)
+
+		return primitive.Timestamp{T: uint32(ts >> 32), I: uint32(ts)}, err
+	}
+
+	return nil, fmt.Errorf("unknown type %q", v.Type)
+}
+
+func encodePageCursor(item X, sorts []SortField, secret []byte) (string, error) {
+	c := &pageCursor{
+		Sorts:  make([]string, 0, len(sorts)),
+		Values: make([]pageCursorValue, 0, len(sorts)),
+	}
+
+	for _, f := range sorts {
+		v, ok := pageSortValue(item, f.Name)
+
+		if !ok || v == nil {
+			return "", fmt.Errorf("yiigo: sort field %s of the item is missing or null", f.Name)
+		}
+
+		cv, err := newPageCursorValue(v)
+
+		if err != nil {
+			return "", err
+		}
+
+		c.Sorts = append(c.Sorts, f.String())
+		c.Values = append(c.Values, cv)
+	}
+
+	b, err := json.Marshal(c)
+
+	if err != nil {
+		return "", fmt.Errorf("yiigo: encode cursor: %w", err)
+	}
+
+	cursor := base64.RawURLEncoding.EncodeToString(b)
+
+	if len(secret) != 0 {
+		cursor += "." + base64.RawURLEncoding.EncodeToString(pageCursorMAC(cursor, secret))
+	}
+
+	return cursor, nil
+}
+
+func decodePageCursor(cursor string, sorts []SortField, secret []byte) ([]interface{}, error) {
+	if len(secret) != 0 {
+		i := strings.LastIndex(cursor, ".")
+
+		if i < 0 {
+			return nil, ErrInvalidCursor
+		}
+
+		mac, err := base64.RawURLEncoding.DecodeString(cursor[i+1:])
+
+		if err != nil || !hmac.Equal(mac, pageCursorMAC(cursor[:i], secret)) {
+			return nil, ErrInvalidCursor
+		}
+
+		cursor = cursor[:i]
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := new(pageCursor)
+
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if len(c.Sorts) != len(sorts) || len(c.Values) != len(sorts) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, 0, len(sorts))
+
+	for i, f := range sorts {
+		if c.Sorts[i] != f.String() {
+			return nil, ErrInvalidCursor
+		}
+
+		v, err := c.Values[i].value()
+
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+func pageCursorMAC(payload string, secret []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+
+	return h.Sum(nil)
+}
+
+// pageSortValue returns the value of the field, the dotted names are looked up in the embedded documents.
+func pageSortValue(item X, name string) (interface{}, bool) {
+	if v, ok := item[name]; ok {
+		return v, true
+	}
+
+	var v interface{} = item
+
+	for _, key := range strings.Split(name, ".") {
+		var ok bool
+
+		switch doc := v.(type) {
+		case X:
+			v, ok = doc[key]
+		case map[string]interface{}:
+			v, ok = doc[key]
+		case primitive.M:
+			v, ok = doc[key]
+		case primitive.D:
+			for _, e := range doc {
+				if e.Key == key {
+					v, ok = e.Value, true
+
+					break
+				}
+			}
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+type mongoPageSource struct {
+	coll *mongo.Collection
+}
+
+// NewMongoPageSource returns the page source of the mongo collection, eg: yiigo.Mongo().Database("test").Collection("users").
+// The filter of `Paginate` expects nil, `bson.M` or `bson.D`.
+func NewMongoPageSource(coll *mongo.Collection) PageSource {
+	return &mongoPageSource{coll: coll}
+}
+
+func (s *mongoPageSource) Fetch(ctx context.Context, filter interface{}, sorts []SortField, after []interface{}, limit int) ([]X, error) {
+	sort := make(bson.D, 0, len(sorts))
+
+	for _, f := range sorts {
+		order := 1
+
+		if f.Desc {
+			order = -1
+		}
+
+		sort = append(sort, bson.E{Key: f.Name, Value: order})
+	}
+
+	cursor, err := s.coll.Find(ctx, mongoPageFilter(filter, sorts, after), options.Find().SetSort(sort).SetLimit(int64(limit)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]X, 0, limit)
+
+	if err = cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// mongoPageFilter returns the filter with the keyset condition,
+// eg: sorts (a, -b) after (1, 2) => {$or: [{a: {$gt: 1}}, {a: 1, b: {$lt: 2}}]}
+func mongoPageFilter(filter interface{}, sorts []SortField, after []interface{}) interface{} {
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	if len(after) == 0 {
+		return filter
+	}
+
+	or := make(bson.A, 0, len(sorts))
+
+	for i, f := range sorts {
+		cond := make(bson.D, 0, i+1)
+
+		for j := 0; j < i; j++ {
+			cond = append(cond, bson.E{Key: sorts[j].Name, Value: after[j]})
+		}
+
+		op := "$gt"
+
+		if f.Desc {
+			op = "$lt"
+		}
+
+		cond = append(cond, bson.E{Key: f.Name, Value: bson.D{{Key: op, Value: after[i]}}})
+
+		or = append(or, cond)
+	}
+
+	return bson.D{{Key: "$and", Value: bson.A{filter, bson.D{{Key: "$or", Value: or}}}}}
+}
+
+// sqlSortFieldRegexp the unqualified column name, since the keys of the scanned rows have no table prefix
+var sqlSortFieldRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type sqlPageSource struct {
+	db       sqlx.ExtContext
+	table    string
+	sortable map[string]bool
+	columns  []string
+}
+
+// NewSQLPageSource returns the page source of the table, the items are the rows scanned by `MapScan`.
+// db expects `*yiigo.RWDB` (reads go to the replicas), `*sqlx.DB` or `*sqlx.Tx`, and columns default to "*".
+// The filter of `Paginate` expects nil or `*yiigo.SQLClause`, eg: yiigo.Clause("status = ?", 1).
+// The sort fields are concatenated into the statement, so they must be the column names in sortable,
+// which should be specified if the sort fields come from the request; nil allows any column name.
+func NewSQLPageSource(db sqlx.ExtContext, table string, sortable []string, columns ...string) PageSource {
+	source := &sqlPageSource{
+		db:      db,
+		table:   table,
+		columns: columns,
+	}
+
+	if len(sortable) != 0 {
+		source.sortable = make(map[string]bool, len(sortable))
+
+		for _, v := range sortable {
+			source.sortable[v] = true
+		}
+	}
+
+	return source
+}
+
+func (s *sqlPageSource) checkSorts(sorts []SortField) error {
+	for _, f := range sorts {
+		if !sqlSortFieldRegexp.MatchString(f.Name) {
+			return fmt.Errorf("yiigo: invalid sql sort field %q", f.Name)
+		}
+
+		if s.sortable != nil && !s.sortable[f.Name] {
+			return fmt.Errorf("yiigo: sql sort field %q is not sortable", f.Name)
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlPageSource) Fetch(ctx context.Context, filter interface{}, sorts []SortField, after []interface{}, limit int) ([]X, error) {
+	query, binds, err := s.query(filter, sorts, after, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryxContext(ctx, query, binds...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := make([]X, 0, limit)
+
+	for rows.Next() {
+		item := make(map[string]interface{})
+
+		if err = rows.MapScan(item); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// query returns the statement with the keyset condition,
+// eg: sorts (a, -b) after (1, 2) => WHERE (filter) AND (a > ? OR (a = ? AND b < ?)) ORDER BY a ASC, b DESC
+func (s *sqlPageSource) query(filter interface{}, sorts []SortField, after []interface{}, limit int) (string, []interface{}, error) {
+	if err := s.checkSorts(sorts); err != nil {
+		return "", nil, err
+	}
+
+	conds := make([]string, 0, 2)
+	binds := make([]interface{}, 0)
+
+	switch v := filter.(type) {
+	case nil:
+	case *SQLClause:
+		if v != nil && len(v.query) != 0 {
+			conds = append(conds, "("+v.query+")")
+			binds = append(binds, v.binds...)
+		}
+	default:
+		return "", nil, fmt.Errorf("yiigo: invalid sql page filter %T, expects *yiigo.SQLClause", filter)
+	}
+
+	if len(after) != 0 {
+		or := make([]string, 0, len(sorts))
+
+		for i, f := range sorts {
+			and := make([]string, 0, i+1)
+
+			for j := 0; j < i; j++ {
+				and = append(and, sorts[j].Name+" = ?")
+				binds = append(binds, after[j])
+			}
+
+			op := " > ?"
+
+			if f.Desc {
+				op = " < ?"
+			}
+
+			and = append(and, f.Name+op)
+			binds = append(binds, after[i])
+
+			if len(and) == 1 {
+				or = append(or, and[0])
+
+				continue
+			}
+
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+
+		conds = append(conds, "("+strings.Join(or, " OR ")+")")
+	}
+
+	orders := make([]string, 0, len(sorts))
+
+	for _, f := range sorts {
+		if f.Desc {
+			orders = append(orders, f.Name+" DESC")
+
+			continue
+		}
+
+		orders = append(orders, f.Name+" ASC")
+	}
+
+	options := []QueryOption{
+		Table(s.table),
+		OrderBy(orders...),
+		Limit(limit),
+	}
+
+	if len(s.columns) != 0 {
+		options = append(options, Select(s.columns...))
+	}
+
+	if len(conds) != 0 {
+		options = append(options, Where(strings.Join(conds, " AND "), binds...))
+	}
+
+	query, binds := NewSQLBuilder(DBDriver(s.db.DriverName())).Wrap(options...).ToQuery()
+
+	return query, binds, nil
+}
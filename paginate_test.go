@@ -0,0 +1,266 @@
+package yiigo
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPageCursor(t *testing.T) {
+	sorts := []SortField{SortDesc("created_at"), SortAsc("_id")}
+
+	oid := primitive.NewObjectID()
+	now := time.Date(2021, 10, 18, 10, 30, 0, 123456789, time.UTC)
+
+	cursor, err := encodePageCursor(X{"created_at": now, "_id": oid, "name": "yiigo"}, sorts, nil)
+
+	assert.Nil(t, err)
+
+	values, err := decodePageCursor(cursor, sorts, nil)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{now, oid}, values)
+
+	// the cursor of other sorts
+	_, err = decodePageCursor(cursor, []SortField{SortAsc("created_at"), SortAsc("_id")}, nil)
+
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	_, err = decodePageCursor("invalid", sorts, nil)
+
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	// the sort fields should be non-null
+	_, err = encodePageCursor(X{"created_at": nil, "_id": oid}, sorts, nil)
+
+	assert.NotNil(t, err)
+
+	// unsupported value type
+	_, err = encodePageCursor(X{"created_at": now, "_id": []int{1}}, sorts, nil)
+
+	assert.NotNil(t, err)
+}
+
+func TestPageCursorValue(t *testing.T) {
+	sorts := []SortField{SortAsc("a"), SortAsc("b"), SortAsc("c"), SortAsc("d"), SortAsc("e"), SortAsc("f"), SortAsc("g"), SortAsc("h")}
+
+	cursor, err := encodePageCursor(X{
+		"a": "yiigo",
+		"b": []byte("raw"),
+		"c": true,
+		"d": int32(-18),
+		"e": uint8(7),
+		"f": float32(1.5),
+		"g": primitive.DateTime(1634553000123),
+		"h": primitive.Timestamp{T: 1634553000, I: 3},
+	}, sorts, nil)
+
+	assert.Nil(t, err)
+
+	values, err := decodePageCursor(cursor, sorts, nil)
+
+	assert.Nil(t, err)
+
+	// the numbers are widened
+	assert.Equal(t, []interface{}{
+		"yiigo",
+		[]byte("raw"),
+		true,
+		int64(-18),
+		uint64(7),
+		float64(1.5),
+		primitive.DateTime(1634553000123),
+		primitive.Timestamp{T: 1634553000, I: 3},
+	}, values)
+
+	// unknown value type
+	_, err = decodePageCursor(base64.RawURLEncoding.EncodeToString([]byte(`{"s":["a"],"v":[{"t":"func","v":""}]}`)), sorts[:1], nil)
+
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestPageCursorSecret(t *testing.T) {
+	sorts := []SortField{SortAsc("id")}
+	secret := []byte("secret")
+
+	cursor, err := encodePageCursor(X{"id": int64(100)}, sorts, secret)
+
+	assert.Nil(t, err)
+
+	values, err := decodePageCursor(cursor, sorts, secret)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(100)}, values)
+
+	// other secret
+	_, err = decodePageCursor(cursor, sorts, []byte("other"))
+
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	// unsigned
+	unsigned, _ := encodePageCursor(X{"id": int64(1)}, sorts, nil)
+
+	_, err = decodePageCursor(unsigned, sorts, secret)
+
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	// tampered
+	forged, _ := encodePageCursor(X{"id": int64(1)}, sorts, nil)
+
+	_, err = decodePageCursor(forged+cursor[strings.LastIndex(cursor, "."):], sorts, secret)
+
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestPageSortValue(t *testing.T) {
+	item := X{
+		"id":      int64(1),
+		"u.name":  "flat",
+		"profile": X{"age": int32(18), "address": bson.D{{Key: "city", Value: "shanghai"}}},
+	}
+
+	v, ok := pageSortValue(item, "id")
+
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), v)
+
+	v, ok = pageSortValue(item, "u.name")
+
+	assert.True(t, ok)
+	assert.Equal(t, "flat", v)
+
+	v, ok = pageSortValue(item, "profile.address.city")
+
+	assert.True(t, ok)
+	assert.Equal(t, "shanghai", v)
+
+	_, ok = pageSortValue(item, "profile.gender")
+
+	assert.False(t, ok)
+}
+
+func TestMongoPageFilter(t *testing.T) {
+	sorts := []SortField{SortAsc("age"), SortDesc("_id")}
+
+	assert.Equal(t, bson.M{"status": 1}, mongoPageFilter(bson.M{"status": 1}, sorts, nil))
+	assert.Equal(t, bson.D{}, mongoPageFilter(nil, sorts, nil))
+
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{
+		bson.M{"status": 1},
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 18}}}},
+			bson.D{{Key: "age", Value: 18}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: 100}}}},
+		}}},
+	}}}, mongoPageFilter(bson.M{"status": 1}, sorts, []interface{}{18, 100}))
+}
+
+func TestSQLPageQuery(t *testing.T) {
+	db := sqlx.NewDb(nil, string(Postgres))
+
+	source := NewSQLPageSource(db, "user", []string{"id", "age"}, "id", "name", "age").(*sqlPageSource)
+
+	sorts := []SortField{SortAsc("age"), SortDesc("id")}
+
+	query, binds, err := source.query(Clause("status = ?", 1), sorts, []interface{}{18, 100}, 11)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id, name, age FROM user WHERE (status = $1) AND (age > $2 OR (age = $3 AND id < $4)) ORDER BY age ASC, id DESC LIMIT $5", query)
+	assert.Equal(t, []interface{}{1, 18, 18, 100, 11}, binds)
+
+	query, binds, err = source.query(nil, sorts, nil, 11)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id, name, age FROM user ORDER BY age ASC, id DESC LIMIT $1", query)
+	assert.Equal(t, []interface{}{11}, binds)
+
+	_, _, err = source.query(bson.M{"status": 1}, sorts, nil, 11)
+
+	assert.NotNil(t, err)
+
+	// not sortable
+	_, _, err = source.query(nil, []SortField{SortAsc("name")}, nil, 11)
+
+	assert.NotNil(t, err)
+
+	// injection
+	source = NewSQLPageSource(db, "user", nil).(*sqlPageSource)
+
+	for _, v := range []string{"id; DROP TABLE user", "(SELECT 1)", "id DESC, age", "", "1id", "a.b.c"} {
+		_, _, err = source.query(nil, []SortField{SortAsc(v)}, nil, 11)
+
+		assert.NotNil(t, err, v)
+	}
+
+	// the keys of the scanned rows are unqualified
+	_, _, err = source.query(nil, []SortField{SortAsc("user.age")}, nil, 11)
+
+	assert.NotNil(t, err)
+
+	query, _, err = source.query(nil, []SortField{SortAsc("age"), SortDesc("_id")}, nil, 11)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT * FROM user ORDER BY age ASC, _id DESC LIMIT $1", query)
+}
+
+func TestPaginate(t *testing.T) {
+	db := sqlx.MustOpen(string(SQLite), "file:yiigo_paginate?mode=memory&cache=shared")
+
+	defer db.Close()
+
+	ctx := context.Background()
+
+	db.MustExec("CREATE TABLE user (id INTEGER PRIMARY KEY, age INTEGER NOT NULL, status INTEGER NOT NULL)")
+
+	for i := 1; i <= 10; i++ {
+		db.MustExec("INSERT INTO user (id, age, status) VALUES (?, ?, ?)", i, 20+i%3, i%5)
+	}
+
+	source := NewSQLPageSource(db, "user", []string{"id", "age"}, "id", "age")
+
+	sorts := []SortField{SortDesc("age"), SortAsc("id")}
+
+	ids := make([]int64, 0)
+	cursor := ""
+	pages := 0
+
+	for {
+		items, next, err := Paginate(ctx, source, Clause("status <> ?", 0), sorts, 3, cursor, WithPageCursorSecret([]byte("secret")))
+
+		assert.Nil(t, err)
+
+		pages++
+
+		for _, v := range items {
+			ids = append(ids, v["id"].(int64))
+		}
+
+		if len(next) == 0 {
+			break
+		}
+
+		cursor = next
+	}
+
+	// status <> 0 excludes 5 and 10, ordered by age desc (22: 2, 8; 21: 1, 4, 7; 20: 3, 6, 9)
+	assert.Equal(t, []int64{2, 8, 1, 4, 7, 3, 6, 9}, ids)
+	assert.Equal(t, 3, pages)
+
+	_, _, err := Paginate(ctx, source, nil, nil, 3, "")
+
+	assert.NotNil(t, err)
+
+	_, _, err = Paginate(ctx, source, nil, sorts, 0, "")
+
+	assert.NotNil(t, err)
+
+	_, _, err = Paginate(ctx, source, nil, sorts, 3, "invalid")
+
+	assert.Equal(t, ErrInvalidCursor, err)
+}
@@ -2,8 +2,10 @@ package yiigo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -14,6 +16,9 @@ import (
 // RedisConn redis connection resource
 type RedisConn struct {
 	redis.Conn
+
+	// addr the address which the connection dialed to
+	addr string
 }
 
 // Close closes the connection resource
@@ -23,6 +28,22 @@ func (rc *RedisConn) Close() {
 	}
 }
 
+// do sends a command and returns the reply, the deadline of ctx is the timeout.
+func (rc *RedisConn) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+
+		// 0 means no timeout
+		if timeout == 0 {
+			timeout = -1
+		}
+
+		return redis.DoWithTimeout(rc.Conn, timeout, cmd, args...)
+	}
+
+	return rc.Do(cmd, args...)
+}
+
 type redisSetting struct {
 	address      string
 	password     string
@@ -31,11 +52,20 @@ type redisSetting struct {
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 	pool         *poolSetting
+	sentinel     *sentinelSetting
+	cluster      *clusterSetting
 }
 
 // RedisOption configures how we set up the redis.
 type RedisOption func(s *redisSetting)
 
+// WithRedisPassword specifies the password for redis.
+func WithRedisPassword(password string) RedisOption {
+	return func(s *redisSetting) {
+		s.password = password
+	}
+}
+
 // WithRedisDatabase specifies the database for redis.
 func WithRedisDatabase(db int) RedisOption {
 	return func(s *redisSetting) {
@@ -83,13 +113,33 @@ type RedisPool interface {
 	Put(rc *RedisConn)
 }
 
+// ErrRedisPoolClosed is returned by Get after the pool is closed by `Shutdown`.
+var ErrRedisPoolClosed = errors.New("yiigo: redis pool is closed")
+
 type redisPoolResource struct {
 	config *redisSetting
 	pool   *vitess_pool.ResourcePool
 	mutex  sync.Mutex
+	closed int32
+
+	// master the current master address discovered by sentinels
+	master atomic.Value
+	stop   chan struct{}
 }
 
-func (r *redisPoolResource) dial() (redis.Conn, error) {
+func (r *redisPoolResource) dial() (*RedisConn, error) {
+	address := r.config.address
+
+	if r.config.sentinel != nil {
+		addr, err := r.discoverMaster()
+
+		if err != nil {
+			return nil, err
+		}
+
+		address = addr
+	}
+
 	dialOptions := []redis.DialOption{
 		redis.DialPassword(r.config.password),
 		redis.DialDatabase(r.config.database),
@@ -98,9 +148,13 @@ func (r *redisPoolResource) dial() (redis.Conn, error) {
 		redis.DialWriteTimeout(r.config.writeTimeout),
 	}
 
-	conn, err := redis.Dial("tcp", r.config.address, dialOptions...)
+	conn, err := redis.Dial("tcp", address, dialOptions...)
 
-	return conn, err
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisConn{Conn: conn, addr: address}, nil
 }
 
 func (r *redisPoolResource) init() {
@@ -118,13 +172,23 @@ func (r *redisPoolResource) init() {
 			return nil, err
 		}
 
-		return &RedisConn{conn}, nil
+		return conn, nil
 	}
 
 	r.pool = vitess_pool.NewResourcePool(df, r.config.pool.size, r.config.pool.limit, r.config.pool.idleTimeout, r.config.pool.prefill)
+
+	if r.config.sentinel != nil {
+		r.stop = make(chan struct{})
+
+		go r.watchMaster(r.stop)
+	}
 }
 
 func (r *redisPoolResource) Get(ctx context.Context) (*RedisConn, error) {
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return &RedisConn{}, ErrRedisPoolClosed
+	}
+
 	if r.pool.IsClosed() {
 		r.init()
 	}
@@ -137,8 +201,8 @@ func (r *redisPoolResource) Get(ctx context.Context) (*RedisConn, error) {
 
 	rc := resource.(*RedisConn)
 
-	// If rc is error, close and reconnect
-	if rc.Err() != nil {
+	// If rc is error or points at a demoted master, close and reconnect
+	if rc.Err() != nil || r.isStale(rc) {
 		conn, err := r.dial()
 
 		if err != nil {
@@ -149,7 +213,7 @@ func (r *redisPoolResource) Get(ctx context.Context) (*RedisConn, error) {
 
 		rc.Close()
 
-		return &RedisConn{conn}, nil
+		return conn, nil
 	}
 
 	return rc, nil
@@ -159,31 +223,66 @@ func (r *redisPoolResource) Put(conn *RedisConn) {
 	r.pool.Put(conn)
 }
 
+// close closes the pool, it waits for all the connections to be returned, and Get fails after that.
+func (r *redisPoolResource) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	atomic.StoreInt32(&r.closed, 1)
+
+	if r.stop != nil {
+		close(r.stop)
+
+		r.stop = nil
+	}
+
+	r.pool.Close()
+}
+
 var (
 	defaultRedis RedisPool
 	redisMap     sync.Map
 )
 
-func newRedis(address string, options ...RedisOption) RedisPool {
-	rp := &redisPoolResource{
-		config: &redisSetting{
-			address:      address,
-			connTimeout:  10 * time.Second,
-			readTimeout:  10 * time.Second,
-			writeTimeout: 10 * time.Second,
-			pool: &poolSetting{
-				size:        10,
-				idleTimeout: 60 * time.Second,
-			},
+func newRedisSetting(address string, options ...RedisOption) *redisSetting {
+	setting := &redisSetting{
+		address:      address,
+		connTimeout:  10 * time.Second,
+		readTimeout:  10 * time.Second,
+		writeTimeout: 10 * time.Second,
+		pool: &poolSetting{
+			size:        10,
+			idleTimeout: 60 * time.Second,
 		},
 	}
 
 	for _, f := range options {
-		f(rp.config)
+		f(setting)
 	}
 
-	if rp.config.pool.limit < rp.config.pool.size {
-		rp.config.pool.limit = rp.config.pool.size
+	if setting.pool.limit < setting.pool.size {
+		setting.pool.limit = setting.pool.size
+	}
+
+	if setting.sentinel != nil {
+		// only the check interval is specified
+		if len(setting.sentinel.addrs) == 0 {
+			setting.sentinel = nil
+		} else if setting.sentinel.checkInterval <= 0 {
+			setting.sentinel.checkInterval = time.Second
+		}
+	}
+
+	return setting
+}
+
+func newRedis(address string, options ...RedisOption) RedisPool {
+	return newRedisPool(newRedisSetting(address, options...))
+}
+
+func newRedisPool(setting *redisSetting) *redisPoolResource {
+	rp := &redisPoolResource{
+		config: setting,
 	}
 
 	rp.init()
@@ -191,22 +290,33 @@ func newRedis(address string, options ...RedisOption) RedisPool {
 	return rp
 }
 
-func initRedis(name, address string, options ...RedisOption) {
-	pool := newRedis(address, options...)
+func initRedis(name, address string, options ...RedisOption) error {
+	setting := newRedisSetting(address, options...)
+
+	if setting.cluster != nil {
+		return initRedisCluster(name, setting)
+	}
+
+	pool := newRedisPool(setting)
 
 	// verify connection
 	conn, err := pool.Get(context.TODO())
 
 	if err != nil {
-		logger.Panic("[yiigo] redis init error", zap.String("name", name), zap.Error(err))
+		pool.close()
+
+		return err
 	}
 
 	if _, err = conn.Do("PING"); err != nil {
-		conn.Close()
+		pool.Put(conn)
+		pool.close()
 
-		logger.Panic("[yiigo] redis init error", zap.String("name", name), zap.Error(err))
+		return err
 	}
 
+	loadRedisScripts(name, conn)
+
 	pool.Put(conn)
 
 	if name == Default {
@@ -216,6 +326,8 @@ func initRedis(name, address string, options ...RedisOption) {
 	redisMap.Store(name, pool)
 
 	logger.Info(fmt.Sprintf("[yiigo] redis.%s is OK", name))
+
+	return nil
 }
 
 // Redis returns a redis pool.
@@ -0,0 +1,264 @@
+package yiigo
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrCacheNotFound the value is not found, the loader of `GetOrLoad` returns it to cache the miss.
+var ErrCacheNotFound = errors.New("yiigo: cache not found")
+
+// the flag byte before the cached value
+const (
+	cacheFlagMissing byte = 0
+	cacheFlagValue   byte = 1
+)
+
+// CacheCodec encodes and decodes the cached values.
+type CacheCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (c jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+type gobCodec struct{}
+
+func (c gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c gobCodec) Unmarshal(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (c msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (c msgpackCodec) Unmarshal(b []byte, v interface{}) error {
+	return msgpack.Unmarshal(b, v)
+}
+
+var (
+	// JSONCodec the cache codec with JSON
+	JSONCodec CacheCodec = jsonCodec{}
+
+	// GobCodec the cache codec with gob
+	GobCodec CacheCodec = gobCodec{}
+
+	// MsgpackCodec the cache codec with msgpack
+	MsgpackCodec CacheCodec = msgpackCodec{}
+)
+
+type cacheSetting struct {
+	prefix      string
+	codec       CacheCodec
+	negativeTTL time.Duration
+	jitter      float64
+}
+
+// CacheOption configures how we set up the cache.
+type CacheOption func(s *cacheSetting)
+
+// WithCachePrefix specifies the prefix of the cache keys.
+func WithCachePrefix(prefix string) CacheOption {
+	return func(s *cacheSetting) {
+		s.prefix = prefix
+	}
+}
+
+// WithCacheCodec specifies the codec of the cached values, default is JSONCodec.
+func WithCacheCodec(codec CacheCodec) CacheOption {
+	return func(s *cacheSetting) {
+		s.codec = codec
+	}
+}
+
+// WithCacheNegativeTTL specifies the ttl of the cached misses, default is 30s, 0 means the misses are not cached.
+func WithCacheNegativeTTL(ttl time.Duration) CacheOption {
+	return func(s *cacheSetting) {
+		s.negativeTTL = ttl
+	}
+}
+
+// WithCacheJitter specifies the ratio of the random extra ttl to avoid the keys expiring at the same time,
+// default is 0.1 (ttl ~ 1.1*ttl).
+func WithCacheJitter(ratio float64) CacheOption {
+	return func(s *cacheSetting) {
+		s.jitter = ratio
+	}
+}
+
+// the concurrent loads of the same key are merged
+var cacheGroup singleflight.Group
+
+// RedisCache the cache-aside helper based on redis.
+type RedisCache struct {
+	name    string
+	client  *RedisClient
+	setting *cacheSetting
+}
+
+// Cache returns a cache on the named redis.
+func Cache(name string, options ...CacheOption) *RedisCache {
+	c := &RedisCache{
+		name:   name,
+		client: NewRedisClient(Redis(name)),
+		setting: &cacheSetting{
+			codec:       JSONCodec,
+			negativeTTL: 30 * time.Second,
+			jitter:      0.1,
+		},
+	}
+
+	for _, f := range options {
+		f(c.setting)
+	}
+
+	return c
+}
+
+// Get decodes the cached value of the key into dest,
+// it returns redis.ErrNil if the key is not cached and ErrCacheNotFound if the miss is cached.
+func (c *RedisCache) Get(ctx context.Context, key string, dest interface{}) error {
+	b, err := c.client.GetBytes(ctx, c.setting.prefix+key)
+
+	if err != nil {
+		return err
+	}
+
+	return c.decode(b, dest)
+}
+
+// Set caches the value of the key with the jittered ttl.
+func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	b, err := c.encode(value)
+
+	if err != nil {
+		return err
+	}
+
+	return c.client.Set(ctx, c.setting.prefix+key, b, c.jitter(ttl))
+}
+
+// Delete deletes the cached keys.
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		prefixed = append(prefixed, c.setting.prefix+k)
+	}
+
+	_, err := c.client.Del(ctx, prefixed...)
+
+	return err
+}
+
+// GetOrLoad decodes the cached value of the key into dest, on miss it calls loader and caches the result with the jittered ttl.
+// The concurrent misses of the same key call loader only once.
+// If loader returns ErrCacheNotFound, the miss is cached with the negative ttl and ErrCacheNotFound is returned.
+// The redis errors are logged and don't fail the load.
+func (c *RedisCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, dest interface{}, loader func() (interface{}, error)) error {
+	err := c.Get(ctx, key, dest)
+
+	if err == nil || errors.Is(err, ErrCacheNotFound) {
+		return err
+	}
+
+	if !errors.Is(err, redis.ErrNil) {
+		logger.Error("[yiigo] cache get error", zap.String("redis", c.name), zap.String("key", key), zap.Error(err))
+	}
+
+	v, err, _ := cacheGroup.Do(c.name+":"+c.setting.prefix+key, func() (interface{}, error) {
+		return c.load(ctx, key, ttl, loader)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return c.decode(v.([]byte), dest)
+}
+
+// load calls loader and returns the encoded value.
+func (c *RedisCache) load(ctx context.Context, key string, ttl time.Duration, loader func() (interface{}, error)) ([]byte, error) {
+	value, err := loader()
+
+	var b []byte
+
+	switch {
+	case errors.Is(err, ErrCacheNotFound):
+		if c.setting.negativeTTL <= 0 {
+			return nil, err
+		}
+
+		b, ttl = []byte{cacheFlagMissing}, c.setting.negativeTTL
+	case err != nil:
+		return nil, err
+	default:
+		if b, err = c.encode(value); err != nil {
+			return nil, err
+		}
+
+		ttl = c.jitter(ttl)
+	}
+
+	if err = c.client.Set(ctx, c.setting.prefix+key, b, ttl); err != nil {
+		logger.Error("[yiigo] cache set error", zap.String("redis", c.name), zap.String("key", key), zap.Error(err))
+	}
+
+	return b, nil
+}
+
+func (c *RedisCache) encode(value interface{}) ([]byte, error) {
+	b, err := c.setting.codec.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{cacheFlagValue}, b...), nil
+}
+
+func (c *RedisCache) decode(b []byte, dest interface{}) error {
+	if len(b) == 0 || b[0] == cacheFlagMissing {
+		return ErrCacheNotFound
+	}
+
+	return c.setting.codec.Unmarshal(b[1:], dest)
+}
+
+func (c *RedisCache) jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 || c.setting.jitter <= 0 {
+		return ttl
+	}
+
+	return ttl + time.Duration(rand.Int63n(int64(float64(ttl)*c.setting.jitter)+1))
+}
@@ -0,0 +1,131 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type cacheUser struct {
+	ID   int64
+	Name string
+}
+
+func TestCacheOption(t *testing.T) {
+	setting := new(cacheSetting)
+
+	options := []CacheOption{
+		WithCachePrefix("user:"),
+		WithCacheCodec(GobCodec),
+		WithCacheNegativeTTL(time.Second),
+		WithCacheJitter(0.2),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &cacheSetting{
+		prefix:      "user:",
+		codec:       GobCodec,
+		negativeTTL: time.Second,
+		jitter:      0.2,
+	}, setting)
+}
+
+func TestCacheCodec(t *testing.T) {
+	for _, codec := range []CacheCodec{JSONCodec, GobCodec, MsgpackCodec} {
+		b, err := codec.Marshal(&cacheUser{ID: 1, Name: "yiigo"})
+
+		assert.Nil(t, err)
+
+		user := new(cacheUser)
+
+		assert.Nil(t, codec.Unmarshal(b, user))
+		assert.Equal(t, &cacheUser{ID: 1, Name: "yiigo"}, user)
+	}
+}
+
+func TestCache(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	redisMap.Store("cache_test", pool)
+
+	defer redisMap.Delete("cache_test")
+
+	cache := Cache("cache_test", WithCachePrefix("user:"), WithCacheCodec(MsgpackCodec), WithCacheJitter(0.5))
+
+	ctx := context.Background()
+
+	var calls int32
+
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+
+		time.Sleep(50 * time.Millisecond)
+
+		return &cacheUser{ID: 1, Name: "yiigo"}, nil
+	}
+
+	// the concurrent misses are merged
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			user := new(cacheUser)
+
+			assert.Nil(t, cache.GetOrLoad(ctx, "1", time.Minute, user, loader))
+			assert.Equal(t, &cacheUser{ID: 1, Name: "yiigo"}, user)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the ttl is jittered
+	ttl := mr.TTL("user:1")
+
+	assert.True(t, ttl >= time.Minute && ttl <= 90*time.Second, ttl)
+
+	// hit
+	user := new(cacheUser)
+
+	assert.Nil(t, cache.GetOrLoad(ctx, "1", time.Minute, user, loader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the miss is cached with the negative ttl
+	notFound := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+
+		return nil, ErrCacheNotFound
+	}
+
+	assert.Equal(t, ErrCacheNotFound, cache.GetOrLoad(ctx, "2", time.Minute, user, notFound))
+	assert.Equal(t, ErrCacheNotFound, cache.GetOrLoad(ctx, "2", time.Minute, user, notFound))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, 30*time.Second, mr.TTL("user:2"))
+
+	// the loader errors are not cached
+	oops := errors.New("oops")
+
+	assert.Equal(t, oops, cache.GetOrLoad(ctx, "3", time.Minute, user, func() (interface{}, error) { return nil, oops }))
+	assert.False(t, mr.Exists("user:3"))
+
+	// set, get and delete
+	assert.Nil(t, cache.Set(ctx, "4", &cacheUser{ID: 4}, 0))
+	assert.Nil(t, cache.Get(ctx, "4", user))
+	assert.Equal(t, &cacheUser{ID: 4}, user)
+	assert.Nil(t, cache.Delete(ctx, "1", "4"))
+	assert.True(t, errors.Is(cache.Get(ctx, "1", user), redis.ErrNil))
+}
@@ -0,0 +1,367 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisZ a member of sorted set with score.
+type RedisZ struct {
+	Member string
+	Score  float64
+}
+
+// RedisClient a redis client with typed commands, it gets and puts the connection of the pool internally.
+// The missing values return redis.ErrNil, eg: errors.Is(err, redis.ErrNil).
+// Context with deadline can specify the timeout for the command.
+type RedisClient struct {
+	pool RedisPool
+}
+
+// NewRedisClient returns a new redis client, eg: yiigo.NewRedisClient(yiigo.Redis("cache")).
+func NewRedisClient(pool RedisPool) *RedisClient {
+	return &RedisClient{pool: pool}
+}
+
+// Pool returns the redis pool of the client.
+func (c *RedisClient) Pool() RedisPool {
+	return c.pool
+}
+
+// Do sends a command to the server and returns the reply.
+func (c *RedisClient) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool.Get(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.pool.Put(conn)
+
+	return conn.do(ctx, cmd, args...)
+}
+
+// Get returns the string value of the key.
+func (c *RedisClient) Get(ctx context.Context, key string) (string, error) {
+	return redis.String(c.Do(ctx, "GET", key))
+}
+
+// GetBytes returns the bytes value of the key.
+func (c *RedisClient) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	return redis.Bytes(c.Do(ctx, "GET", key))
+}
+
+// MGet returns the values of the keys, the missing values are nil.
+func (c *RedisClient) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	return redis.ByteSlices(c.Do(ctx, "MGET", redis.Args{}.AddFlat(keys)...))
+}
+
+// Set sets the value of the key, ttl <= 0 means no expiration.
+func (c *RedisClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	args := redis.Args{key, value}
+
+	if ttl > 0 {
+		args = args.Add("PX", ttl.Milliseconds())
+	}
+
+	_, err := c.Do(ctx, "SET", args...)
+
+	return err
+}
+
+// SetNX sets the value of the key if it doesn't exist, ttl <= 0 means no expiration.
+func (c *RedisClient) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	args := redis.Args{key, value}
+
+	if ttl > 0 {
+		args = args.Add("PX", ttl.Milliseconds())
+	}
+
+	args = args.Add("NX")
+
+	reply, err := redis.String(c.Do(ctx, "SET", args...))
+
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return reply == "OK", nil
+}
+
+// Del deletes the keys and returns the number of the deleted.
+func (c *RedisClient) Del(ctx context.Context, keys ...string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "DEL", redis.Args{}.AddFlat(keys)...))
+}
+
+// Exists returns the number of the existing keys.
+func (c *RedisClient) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "EXISTS", redis.Args{}.AddFlat(keys)...))
+}
+
+// Expire sets the expiration of the key, returns false if the key doesn't exist.
+func (c *RedisClient) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return redis.Bool(c.Do(ctx, "PEXPIRE", key, ttl.Milliseconds()))
+}
+
+// TTL returns the remaining time to live of the key,
+// it's -1 if the key has no expiration and -2 if the key doesn't exist.
+func (c *RedisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := redis.Int64(c.Do(ctx, "PTTL", key))
+
+	if err != nil {
+		return 0, err
+	}
+
+	if ms < 0 {
+		return time.Duration(ms), nil
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Incr increments the value of the key by 1.
+func (c *RedisClient) Incr(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "INCR", key))
+}
+
+// IncrBy increments the value of the key by n.
+func (c *RedisClient) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return redis.Int64(c.Do(ctx, "INCRBY", key, n))
+}
+
+// HSet sets the fields of the hash, eg: HSet(ctx, key, "name", "yiigo", "age", 29).
+func (c *RedisClient) HSet(ctx context.Context, key string, fieldValues ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "HSET", redis.Args{key}.Add(fieldValues...)...))
+}
+
+// HSetStruct sets the fields of the hash from a struct, the field names are specified by the `redis` tags.
+func (c *RedisClient) HSetStruct(ctx context.Context, key string, obj interface{}) error {
+	_, err := c.Do(ctx, "HMSET", redis.Args{key}.AddFlat(obj)...)
+
+	return err
+}
+
+// HGet returns the value of the hash field.
+func (c *RedisClient) HGet(ctx context.Context, key, field string) (string, error) {
+	return redis.String(c.Do(ctx, "HGET", key, field))
+}
+
+// HGetAll returns all the fields of the hash.
+func (c *RedisClient) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return redis.StringMap(c.Do(ctx, "HGETALL", key))
+}
+
+// HGetAllStruct scans all the fields of the hash into dest (a pointer to struct) by the `redis` tags,
+// returns redis.ErrNil if the key doesn't exist.
+func (c *RedisClient) HGetAllStruct(ctx context.Context, key string, dest interface{}) error {
+	values, err := redis.Values(c.Do(ctx, "HGETALL", key))
+
+	if err != nil {
+		return err
+	}
+
+	if len(values) == 0 {
+		return redis.ErrNil
+	}
+
+	return redis.ScanStruct(values, dest)
+}
+
+// HDel deletes the fields of the hash.
+func (c *RedisClient) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "HDEL", redis.Args{key}.AddFlat(fields)...))
+}
+
+// HIncrBy increments the value of the hash field by n.
+func (c *RedisClient) HIncrBy(ctx context.Context, key, field string, n int64) (int64, error) {
+	return redis.Int64(c.Do(ctx, "HINCRBY", key, field, n))
+}
+
+// SAdd adds the members to the set.
+func (c *RedisClient) SAdd(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "SADD", redis.Args{key}.Add(members...)...))
+}
+
+// SRem removes the members from the set.
+func (c *RedisClient) SRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "SREM", redis.Args{key}.Add(members...)...))
+}
+
+// SMembers returns all the members of the set.
+func (c *RedisClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	return redis.Strings(c.Do(ctx, "SMEMBERS", key))
+}
+
+// SIsMember reports whether member is a member of the set.
+func (c *RedisClient) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return redis.Bool(c.Do(ctx, "SISMEMBER", key, member))
+}
+
+// ZAdd adds the members to the sorted set.
+func (c *RedisClient) ZAdd(ctx context.Context, key string, members ...RedisZ) (int64, error) {
+	args := redis.Args{key}
+
+	for _, m := range members {
+		args = args.Add(m.Score, m.Member)
+	}
+
+	return redis.Int64(c.Do(ctx, "ZADD", args...))
+}
+
+// ZRem removes the members from the sorted set.
+func (c *RedisClient) ZRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "ZREM", redis.Args{key}.Add(members...)...))
+}
+
+// ZScore returns the score of the member.
+func (c *RedisClient) ZScore(ctx context.Context, key string, member interface{}) (float64, error) {
+	return redis.Float64(c.Do(ctx, "ZSCORE", key, member))
+}
+
+// ZCard returns the number of the members of the sorted set.
+func (c *RedisClient) ZCard(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "ZCARD", key))
+}
+
+// ZRangeByScore returns the members with scores between min and max (eg: "-inf", "(1", "10"),
+// count <= 0 means no LIMIT.
+func (c *RedisClient) ZRangeByScore(ctx context.Context, key, min, max string, offset, count int64) ([]RedisZ, error) {
+	args := redis.Args{key, min, max, "WITHSCORES"}
+
+	if count > 0 {
+		args = args.Add("LIMIT", offset, count)
+	}
+
+	return redisZs(c.Do(ctx, "ZRANGEBYSCORE", args...))
+}
+
+// ZRevRangeByScore returns the members with scores between max and min in descending order,
+// count <= 0 means no LIMIT.
+func (c *RedisClient) ZRevRangeByScore(ctx context.Context, key, max, min string, offset, count int64) ([]RedisZ, error) {
+	args := redis.Args{key, max, min, "WITHSCORES"}
+
+	if count > 0 {
+		args = args.Add("LIMIT", offset, count)
+	}
+
+	return redisZs(c.Do(ctx, "ZREVRANGEBYSCORE", args...))
+}
+
+// Scan returns an iterator of the keys which match the pattern (empty means all),
+// count is the hint of the number of the keys for each SCAN.
+func (c *RedisClient) Scan(match string, count int64) *RedisScanner {
+	return &RedisScanner{
+		client: c,
+		match:  match,
+		count:  count,
+		cursor: "0",
+	}
+}
+
+// RedisScanner the iterator of SCAN, eg:
+//
+//	scanner := client.Scan("user:*", 100)
+//
+//	for scanner.Next(ctx) {
+//		fmt.Println(scanner.Key())
+//	}
+//
+//	if err := scanner.Err(); err != nil {
+//		return err
+//	}
+type RedisScanner struct {
+	client *RedisClient
+	match  string
+	count  int64
+	cursor string
+	keys   []string
+	key    string
+	done   bool
+	err    error
+}
+
+// Next advances to the next key, it returns false when the iteration is finished or an error occurs.
+func (s *RedisScanner) Next(ctx context.Context) bool {
+	for len(s.keys) == 0 {
+		if s.done || s.err != nil {
+			return false
+		}
+
+		s.scan(ctx)
+	}
+
+	s.key, s.keys = s.keys[0], s.keys[1:]
+
+	return true
+}
+
+// Key returns the current key.
+func (s *RedisScanner) Key() string {
+	return s.key
+}
+
+// Err returns the error of the iteration.
+func (s *RedisScanner) Err() error {
+	return s.err
+}
+
+func (s *RedisScanner) scan(ctx context.Context) {
+	args := redis.Args{s.cursor}
+
+	if len(s.match) != 0 {
+		args = args.Add("MATCH", s.match)
+	}
+
+	if s.count > 0 {
+		args = args.Add("COUNT", s.count)
+	}
+
+	values, err := redis.Values(s.client.Do(ctx, "SCAN", args...))
+
+	if err != nil {
+		s.err = err
+
+		return
+	}
+
+	var keys []string
+
+	if _, err = redis.Scan(values, &s.cursor, &keys); err != nil {
+		s.err = err
+
+		return
+	}
+
+	s.keys = keys
+	s.done = s.cursor == "0"
+}
+
+func redisZs(reply interface{}, err error) ([]RedisZ, error) {
+	values, err := redis.Strings(reply, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	zs := make([]RedisZ, 0, len(values)/2)
+
+	for i := 0; i+1 < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		zs = append(zs, RedisZ{Member: values[i], Score: score})
+	}
+
+	return zs, nil
+}
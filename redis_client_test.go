@@ -0,0 +1,206 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type redisUser struct {
+	Name string `redis:"name"`
+	Age  int    `redis:"age"`
+}
+
+func TestRedisClient(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	client := NewRedisClient(pool)
+
+	ctx := context.Background()
+
+	// strings
+	_, err := client.Get(ctx, "name")
+
+	assert.True(t, errors.Is(err, redis.ErrNil))
+
+	assert.Nil(t, client.Set(ctx, "name", "yiigo", time.Minute))
+	assert.Equal(t, time.Minute, mr.TTL("name"))
+
+	s, err := client.Get(ctx, "name")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "yiigo", s)
+
+	ok, err := client.SetNX(ctx, "name", "other", 0)
+
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = client.SetNX(ctx, "lock", "1", time.Second)
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	values, err := client.MGet(ctx, "name", "missing")
+
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("yiigo"), nil}, values)
+
+	n, err := client.Incr(ctx, "counter")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = client.IncrBy(ctx, "counter", 10)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), n)
+
+	ok, err = client.Expire(ctx, "counter", 10*time.Second)
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ttl, err := client.TTL(ctx, "counter")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, ttl)
+
+	n, err = client.Exists(ctx, "name", "counter", "missing")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = client.Del(ctx, "counter", "lock")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// hashes
+	assert.Nil(t, client.HSetStruct(ctx, "user:1", &redisUser{Name: "yiigo", Age: 29}))
+
+	n, err = client.HSet(ctx, "user:1", "city", "shanghai")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	m, err := client.HGetAll(ctx, "user:1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"name": "yiigo", "age": "29", "city": "shanghai"}, m)
+
+	user := new(redisUser)
+
+	assert.Nil(t, client.HGetAllStruct(ctx, "user:1", user))
+	assert.Equal(t, &redisUser{Name: "yiigo", Age: 29}, user)
+	assert.True(t, errors.Is(client.HGetAllStruct(ctx, "user:2", user), redis.ErrNil))
+
+	n, err = client.HIncrBy(ctx, "user:1", "age", 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), n)
+
+	s, err = client.HGet(ctx, "user:1", "age")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "30", s)
+
+	n, err = client.HDel(ctx, "user:1", "city", "missing")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// sets
+	n, err = client.SAdd(ctx, "tags", "go", "redis", "go")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	ok, err = client.SIsMember(ctx, "tags", "redis")
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	n, err = client.SRem(ctx, "tags", "redis")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	members, err := client.SMembers(ctx, "tags")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"go"}, members)
+
+	// sorted sets
+	n, err = client.ZAdd(ctx, "rank", RedisZ{Member: "a", Score: 1}, RedisZ{Member: "b", Score: 2.5}, RedisZ{Member: "c", Score: 3})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	zs, err := client.ZRangeByScore(ctx, "rank", "(1", "+inf", 0, 0)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []RedisZ{{Member: "b", Score: 2.5}, {Member: "c", Score: 3}}, zs)
+
+	zs, err = client.ZRevRangeByScore(ctx, "rank", "+inf", "-inf", 1, 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []RedisZ{{Member: "b", Score: 2.5}}, zs)
+
+	score, err := client.ZScore(ctx, "rank", "c")
+
+	assert.Nil(t, err)
+	assert.Equal(t, float64(3), score)
+
+	n, err = client.ZRem(ctx, "rank", "a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = client.ZCard(ctx, "rank")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// ctx with deadline
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+
+	s, err = client.Get(tctx, "name")
+
+	cancel()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "yiigo", s)
+}
+
+func TestRedisScanner(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	for i := 0; i < 25; i++ {
+		mr.Set(fmt.Sprintf("scan:%02d", i), "1")
+	}
+
+	mr.Set("other", "1")
+
+	scanner := NewRedisClient(pool).Scan("scan:*", 10)
+
+	keys := make([]string, 0)
+
+	for scanner.Next(context.Background()) {
+		keys = append(keys, scanner.Key())
+	}
+
+	assert.Nil(t, scanner.Err())
+
+	sort.Strings(keys)
+
+	assert.Equal(t, 25, len(keys))
+	assert.Equal(t, "scan:00", keys[0])
+	assert.Equal(t, "scan:24", keys[24])
+}
@@ -0,0 +1,535 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// redisClusterSlots the number of hash slots of redis cluster.
+const redisClusterSlots = 16384
+
+type clusterSetting struct {
+	addrs        []string
+	maxRedirects int
+}
+
+// WithRedisCluster specifies the redis is a cluster, the address of `WithRedis` and addrs are the seed nodes.
+// The cluster is accessed by `RedisCluster` instead of `Redis`, each master node has its own pool configured by the other options.
+func WithRedisCluster(addrs ...string) RedisOption {
+	return func(s *redisSetting) {
+		s.cluster = &clusterSetting{
+			addrs:        addrs,
+			maxRedirects: 5,
+		}
+	}
+}
+
+// RedisClusterClient redis cluster client, it loads the topology by `CLUSTER SLOTS`,
+// keeps one pool per master node and routes the commands by hash slot.
+type RedisClusterClient struct {
+	config *redisSetting
+	seeds  []string
+	slots  [redisClusterSlots]string
+
+	// masters the master nodes in the current slot map
+	masters []string
+
+	// nodes the pools of the masters, and of the seeds and redirect targets until the next refresh
+	nodes map[string]*redisPoolResource
+	mutex sync.RWMutex
+
+	// refreshing guards against refreshing the topology concurrently
+	refreshing int32
+}
+
+func newRedisCluster(setting *redisSetting) *RedisClusterClient {
+	seeds := make([]string, 0, len(setting.cluster.addrs)+1)
+
+	if len(setting.address) != 0 {
+		seeds = append(seeds, setting.address)
+	}
+
+	seeds = append(seeds, setting.cluster.addrs...)
+
+	return &RedisClusterClient{
+		config: setting,
+		seeds:  seeds,
+		nodes:  make(map[string]*redisPoolResource),
+	}
+}
+
+// Do sends a command to the node which serves the key and returns the reply.
+// The key is the first argument, except EVAL/EVALSHA/FCALL (the first key after numkeys)
+// and XREAD/XREADGROUP (the first stream after STREAMS), and `{hashtag}` is supported, eg: SET {user:1}:name yiigo.
+// The commands without keys are sent to a random node.
+// The `MOVED` and `ASK` redirects are followed, and the topology is refreshed on `MOVED`.
+func (c *RedisClusterClient) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	slot := -1
+
+	if key, ok := clusterCommandKey(cmd, args); ok {
+		slot = clusterSlot(key)
+	}
+
+	addr, err := c.slotNode(slot)
+
+	if err != nil {
+		return nil, err
+	}
+
+	asking := false
+
+	for i := 0; i <= c.config.cluster.maxRedirects; i++ {
+		reply, err := c.doNode(ctx, addr, asking, cmd, args...)
+
+		if err == nil {
+			return reply, nil
+		}
+
+		var rerr redis.Error
+
+		if !errors.As(err, &rerr) {
+			// the node may be down, reload the topology for the next commands
+			go c.refresh()
+
+			return nil, err
+		}
+
+		kind, target, ok := parseRedirect(rerr)
+
+		if !ok {
+			return nil, err
+		}
+
+		asking = kind == "ASK"
+
+		if !asking && slot >= 0 {
+			c.mutex.Lock()
+			c.slots[slot] = target
+			c.mutex.Unlock()
+
+			go c.refresh()
+		}
+
+		addr = target
+	}
+
+	return nil, fmt.Errorf("yiigo: redis cluster too many redirects (%s)", cmd)
+}
+
+// NodePool returns the pool of the node which serves the key,
+// it can be used to send several commands with the same slot (eg: MULTI/EXEC with `{hashtag}` keys).
+func (c *RedisClusterClient) NodePool(key string) (RedisPool, error) {
+	addr, err := c.slotNode(clusterSlot(key))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.node(addr), nil
+}
+
+// Nodes returns the addresses of the master nodes in the current slot map,
+// the nodes which have left the cluster are removed when the topology is refreshed.
+func (c *RedisClusterClient) Nodes() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	addrs := make([]string, len(c.masters))
+
+	copy(addrs, c.masters)
+
+	return addrs
+}
+
+func (c *RedisClusterClient) doNode(ctx context.Context, addr string, asking bool, cmd string, args ...interface{}) (interface{}, error) {
+	pool, conn, err := c.nodeConn(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer pool.Put(conn)
+
+	if asking {
+		if _, err = conn.do(ctx, "ASKING"); err != nil {
+			return nil, err
+		}
+	}
+
+	return conn.do(ctx, cmd, args...)
+}
+
+// nodeConn gets a connection from the pool of the node. The pool may be closed by a concurrent refresh
+// after it's looked up (eg: a redirect target which isn't a master), then it's retried against the new nodes.
+func (c *RedisClusterClient) nodeConn(ctx context.Context, addr string) (*redisPoolResource, *RedisConn, error) {
+	pool := c.node(addr)
+
+	conn, err := pool.Get(ctx)
+
+	if errors.Is(err, ErrRedisPoolClosed) {
+		// the same pool means the cluster is closed
+		if fresh := c.node(addr); fresh != pool {
+			pool = fresh
+
+			conn, err = pool.Get(ctx)
+		}
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pool, conn, nil
+}
+
+// slotNode returns the address of the node which serves the slot, slot -1 means any node.
+func (c *RedisClusterClient) slotNode(slot int) (string, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if slot >= 0 && len(c.slots[slot]) != 0 {
+		return c.slots[slot], nil
+	}
+
+	if len(c.masters) != 0 {
+		return c.masters[rand.Intn(len(c.masters))], nil
+	}
+
+	if len(c.seeds) == 0 {
+		return "", errors.New("yiigo: redis cluster has no nodes")
+	}
+
+	return c.seeds[0], nil
+}
+
+// node returns the pool of the node, creates it if not exists.
+func (c *RedisClusterClient) node(addr string) *redisPoolResource {
+	c.mutex.RLock()
+	pool, ok := c.nodes[addr]
+	c.mutex.RUnlock()
+
+	if ok {
+		return pool
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if pool, ok = c.nodes[addr]; ok {
+		return pool
+	}
+
+	setting := *c.config
+
+	setting.address = addr
+	setting.cluster = nil
+	setting.sentinel = nil
+	// cluster only supports the database 0
+	setting.database = 0
+
+	pool = newRedisPool(&setting)
+
+	c.nodes[addr] = pool
+
+	return pool
+}
+
+// refresh reloads the topology in the background, it's skipped when another refresh is running.
+func (c *RedisClusterClient) refresh() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+
+	defer atomic.StoreInt32(&c.refreshing, 0)
+
+	if err := c.loadSlots(context.Background()); err != nil {
+		logger.Error("[yiigo] redis cluster refresh error", zap.Error(err))
+	}
+}
+
+// loadSlots loads the topology by `CLUSTER SLOTS` from the known nodes and the seeds.
+func (c *RedisClusterClient) loadSlots(ctx context.Context) error {
+	addrs := c.Nodes()
+
+	addrs = append(addrs, c.seeds...)
+
+	var lastErr error
+
+	for _, addr := range addrs {
+		slots, err := c.clusterSlots(ctx, addr)
+
+		if err != nil {
+			lastErr = err
+
+			continue
+		}
+
+		seen := make(map[string]bool)
+		masters := make([]string, 0)
+
+		for _, node := range slots {
+			if len(node) != 0 && !seen[node] {
+				seen[node] = true
+				masters = append(masters, node)
+
+				c.node(node)
+			}
+		}
+
+		sort.Strings(masters)
+
+		// rebuild the nodes from the slot map, the others (left the cluster, seeds, redirect targets) are closed
+		stale := make([]*redisPoolResource, 0)
+
+		c.mutex.Lock()
+
+		c.slots = slots
+		c.masters = masters
+
+		for node, pool := range c.nodes {
+			if !seen[node] {
+				delete(c.nodes, node)
+
+				stale = append(stale, pool)
+			}
+		}
+
+		c.mutex.Unlock()
+
+		// close waits for the connections in use to be returned
+		for _, pool := range stale {
+			go pool.close()
+		}
+
+		return nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no nodes")
+	}
+
+	return fmt.Errorf("yiigo: redis cluster slots not loaded: %w", lastErr)
+}
+
+func (c *RedisClusterClient) clusterSlots(ctx context.Context, addr string) ([redisClusterSlots]string, error) {
+	var slots [redisClusterSlots]string
+
+	pool, conn, err := c.nodeConn(ctx, addr)
+
+	if err != nil {
+		return slots, err
+	}
+
+	defer pool.Put(conn)
+
+	ranges, err := redis.Values(conn.do(ctx, "CLUSTER", "SLOTS"))
+
+	if err != nil {
+		return slots, err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+
+	for _, v := range ranges {
+		// [start, end, [ip, port, id], replicas...]
+		item, err := redis.Values(v, nil)
+
+		if err != nil || len(item) < 3 {
+			return slots, fmt.Errorf("unexpected cluster slots reply %v", v)
+		}
+
+		start, _ := redis.Int(item[0], nil)
+		end, _ := redis.Int(item[1], nil)
+
+		master, err := redis.Values(item[2], nil)
+
+		if err != nil || len(master) < 2 {
+			return slots, fmt.Errorf("unexpected cluster slots reply %v", v)
+		}
+
+		ip, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+
+		// an empty ip means the node which we are asking
+		if len(ip) == 0 {
+			ip = host
+		}
+
+		node := net.JoinHostPort(ip, strconv.Itoa(port))
+
+		for i := start; i <= end && i < redisClusterSlots; i++ {
+			slots[i] = node
+		}
+	}
+
+	return slots, nil
+}
+
+// loadScripts preloads the registered scripts into the master nodes, the nodes which join later or lose the scripts
+// (eg: restarts, failovers) load them by the NOSCRIPT fallback of `RedisScript`, the redials never reload them.
+func (c *RedisClusterClient) loadScripts(name string) {
+	for _, addr := range c.Nodes() {
+		pool, conn, err := c.nodeConn(context.TODO(), addr)
+
+		if err != nil {
+			logger.Error("[yiigo] redis script load error", zap.String("redis", name), zap.String("node", addr), zap.Error(err))
+
+			continue
+		}
+
+		loadRedisScripts(name+"."+addr, conn)
+
+		pool.Put(conn)
+	}
+}
+
+// close closes the pools of all nodes.
+func (c *RedisClusterClient) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, pool := range c.nodes {
+		pool.close()
+	}
+}
+
+// parseRedirect parses the error like "MOVED 3999 127.0.0.1:6381" and "ASK 3999 127.0.0.1:6381".
+func parseRedirect(err redis.Error) (kind, addr string, ok bool) {
+	fields := strings.Fields(string(err))
+
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", "", false
+	}
+
+	return fields[0], fields[2], true
+}
+
+// clusterCommandKey returns the key which the command is routed by.
+func clusterCommandKey(cmd string, args []interface{}) (string, bool) {
+	switch strings.ToUpper(cmd) {
+	case "EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO":
+		// script numkeys key [key ...] arg [arg ...]
+		if len(args) < 3 {
+			return "", false
+		}
+
+		if n, err := strconv.Atoi(clusterKey(args[1])); err != nil || n <= 0 {
+			return "", false
+		}
+
+		return clusterKey(args[2]), true
+	case "XREAD", "XREADGROUP":
+		// ... STREAMS key [key ...] id [id ...]
+		for i, v := range args {
+			if strings.EqualFold(clusterKey(v), "STREAMS") && i+1 < len(args) {
+				return clusterKey(args[i+1]), true
+			}
+		}
+
+		return "", false
+	}
+
+	if len(args) == 0 {
+		return "", false
+	}
+
+	return clusterKey(args[0]), true
+}
+
+func clusterKey(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// clusterSlot returns the hash slot of the key, only the `{hashtag}` is hashed if the key has.
+func clusterSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % redisClusterSlots)
+}
+
+// crc16 the CRC16-CCITT (XMODEM) which redis cluster uses.
+func crc16(s string) uint16 {
+	var crc uint16
+
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+var (
+	defaultRedisCluster *RedisClusterClient
+	redisClusterMap     sync.Map
+)
+
+func initRedisCluster(name string, setting *redisSetting) error {
+	cluster := newRedisCluster(setting)
+
+	if err := cluster.loadSlots(context.TODO()); err != nil {
+		cluster.close()
+
+		return err
+	}
+
+	cluster.loadScripts(name)
+
+	if name == Default {
+		defaultRedisCluster = cluster
+	}
+
+	redisClusterMap.Store(name, cluster)
+
+	logger.Info(fmt.Sprintf("[yiigo] redis.%s (cluster) is OK", name))
+
+	return nil
+}
+
+// RedisCluster returns a redis cluster client.
+func RedisCluster(name ...string) *RedisClusterClient {
+	if len(name) == 0 || name[0] == Default {
+		if defaultRedisCluster == nil {
+			logger.Panic(fmt.Sprintf("[yiigo] unknown redis.%s (forgotten configure?)", Default))
+		}
+
+		return defaultRedisCluster
+	}
+
+	v, ok := redisClusterMap.Load(name[0])
+
+	if !ok {
+		logger.Panic(fmt.Sprintf("[yiigo] unknown redis.%s (forgotten configure?)", name[0]))
+	}
+
+	return v.(*RedisClusterClient)
+}
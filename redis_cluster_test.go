@@ -0,0 +1,434 @@
+package yiigo
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCluster a redis cluster with 2 nodes, node 0 serves the slots [0, split) and node 1 serves the others.
+type fakeCluster struct {
+	nodes []*server.Server
+	data  []map[string]string
+	// scripts the hashes of the loaded scripts
+	scripts []map[string]bool
+	split   int
+	// ask the slots which are migrating to node 1
+	ask   map[int]bool
+	mutex sync.Mutex
+}
+
+func newFakeCluster(t *testing.T, split int) *fakeCluster {
+	c := &fakeCluster{
+		split: split,
+		ask:   make(map[int]bool),
+	}
+
+	for i := 0; i < 2; i++ {
+		srv, err := server.NewServer("127.0.0.1:0")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.nodes = append(c.nodes, srv)
+		c.data = append(c.data, make(map[string]string))
+		c.scripts = append(c.scripts, make(map[string]bool))
+
+		c.register(i, srv)
+	}
+
+	t.Cleanup(func() {
+		for _, srv := range c.nodes {
+			srv.Close()
+		}
+	})
+
+	return c
+}
+
+func (c *fakeCluster) addr(i int) string {
+	return c.nodes[i].Addr().String()
+}
+
+func (c *fakeCluster) register(i int, srv *server.Server) {
+	srv.Register("PING", func(p *server.Peer, cmd string, args []string) {
+		p.WriteInline("PONG")
+	})
+
+	srv.Register("ASKING", func(p *server.Peer, cmd string, args []string) {
+		p.Ctx = true
+		p.WriteOK()
+	})
+
+	srv.Register("CLUSTER", func(p *server.Peer, cmd string, args []string) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		p.WriteLen(2)
+
+		for n, r := range [][2]int{{0, c.split - 1}, {c.split, redisClusterSlots - 1}} {
+			p.WriteLen(3)
+			p.WriteInt(r[0])
+			p.WriteInt(r[1])
+			p.WriteLen(2)
+			p.WriteBulk("127.0.0.1")
+			p.WriteInt(c.nodes[n].Addr().Port)
+		}
+	})
+
+	srv.Register("SCRIPT", func(p *server.Peer, cmd string, args []string) {
+		if len(args) != 2 || !strings.EqualFold(args[0], "LOAD") {
+			p.WriteError("ERR unknown subcommand")
+
+			return
+		}
+
+		h := sha1.Sum([]byte(args[1]))
+		hash := hex.EncodeToString(h[:])
+
+		c.mutex.Lock()
+		c.scripts[i][hash] = true
+		c.mutex.Unlock()
+
+		p.WriteBulk(hash)
+	})
+
+	srv.Register("GET", func(p *server.Peer, cmd string, args []string) {
+		if v, ok := c.route(i, p, args[0]); ok {
+			if len(v) == 0 {
+				p.WriteNull()
+			} else {
+				p.WriteBulk(v)
+			}
+		}
+	})
+
+	srv.Register("SET", func(p *server.Peer, cmd string, args []string) {
+		if _, ok := c.route(i, p, args[0]); ok {
+			c.mutex.Lock()
+			c.data[i][args[0]] = args[1]
+			c.mutex.Unlock()
+
+			p.WriteOK()
+		}
+	})
+}
+
+// route writes the redirect and returns false if the key is not served by node i.
+func (c *fakeCluster) route(i int, p *server.Peer, key string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	asking := p.Ctx == true
+	p.Ctx = nil
+
+	slot := clusterSlot(key)
+
+	owner := 1
+
+	if slot < c.split {
+		owner = 0
+	}
+
+	v, exists := c.data[i][key]
+
+	if i != owner {
+		if asking && c.ask[slot] && i == 1 {
+			return v, true
+		}
+
+		p.WriteError(fmt.Sprintf("MOVED %d %s", slot, c.addr(owner)))
+
+		return "", false
+	}
+
+	if c.ask[slot] && !exists {
+		p.WriteError(fmt.Sprintf("ASK %d %s", slot, c.addr(1)))
+
+		return "", false
+	}
+
+	return v, true
+}
+
+func TestClusterSlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), crc16("123456789"))
+	assert.Equal(t, 12182, clusterSlot("foo"))
+	assert.Equal(t, 5061, clusterSlot("bar"))
+	assert.Equal(t, clusterSlot("user1000"), clusterSlot("{user1000}.following"))
+	assert.Equal(t, clusterSlot("{user1000}.following"), clusterSlot("{user1000}.followers"))
+	assert.Equal(t, clusterSlot("foo{}{bar}"), clusterSlot("foo{}{bar}"))
+	assert.NotEqual(t, clusterSlot("bar"), clusterSlot("foo{}{bar}"))
+}
+
+func TestRedisCluster(t *testing.T) {
+	fc := newFakeCluster(t, 8192)
+
+	setting := newRedisSetting("127.0.0.1:1", WithRedisCluster(fc.addr(1)))
+
+	cluster := newRedisCluster(setting)
+
+	defer cluster.close()
+
+	ctx := context.Background()
+
+	// the first seed is down
+	assert.Nil(t, cluster.loadSlots(ctx))
+
+	_, err := cluster.Do(ctx, "SET", "foo", "1")
+
+	assert.Nil(t, err)
+
+	_, err = cluster.Do(ctx, "SET", "bar", "2")
+
+	assert.Nil(t, err)
+
+	assert.Equal(t, "1", fc.data[1]["foo"])
+	assert.Equal(t, "2", fc.data[0]["bar"])
+
+	v, err := redis.String(cluster.Do(ctx, "GET", "foo"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+
+	pool, err := cluster.NodePool("{bar}:name")
+
+	assert.Nil(t, err)
+	assert.Equal(t, fc.addr(0), pool.(*redisPoolResource).config.address)
+
+	// MOVED: foo is migrated to node 0
+	fc.mutex.Lock()
+	fc.split = 13000
+	fc.data[0]["foo"] = fc.data[1]["foo"]
+	delete(fc.data[1], "foo")
+	fc.mutex.Unlock()
+
+	v, err = redis.String(cluster.Do(ctx, "GET", "foo"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1", v)
+
+	addr, _ := cluster.slotNode(clusterSlot("foo"))
+
+	assert.Equal(t, fc.addr(0), addr)
+
+	// the topology is refreshed in the background
+	assert.Eventually(t, func() bool {
+		addr, _ := cluster.slotNode(12999)
+
+		return addr == fc.addr(0)
+	}, time.Second, 10*time.Millisecond)
+
+	// ASK: the slot of bar is migrating to node 1
+	fc.mutex.Lock()
+	fc.ask[clusterSlot("bar")] = true
+	fc.mutex.Unlock()
+
+	v, err = redis.String(cluster.Do(ctx, "GET", "bar"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "2", v)
+
+	_, err = cluster.Do(ctx, "SET", "{bar}:new", "3")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "3", fc.data[1]["{bar}:new"])
+
+	// ASK doesn't change the topology
+	addr, _ = cluster.slotNode(clusterSlot("bar"))
+
+	assert.Equal(t, fc.addr(0), addr)
+
+	// the other errors are returned
+	_, err = cluster.Do(ctx, "UNKNOWN", "foo")
+
+	assert.True(t, strings.Contains(err.Error(), "unknown command"))
+}
+
+func TestRedisClusterNodes(t *testing.T) {
+	fc := newFakeCluster(t, 8192)
+
+	cluster := newRedisCluster(newRedisSetting(fc.addr(0), WithRedisCluster()))
+
+	defer cluster.close()
+
+	ctx := context.Background()
+
+	assert.Nil(t, cluster.loadSlots(ctx))
+
+	nodes := []string{fc.addr(0), fc.addr(1)}
+
+	sort.Strings(nodes)
+
+	assert.Equal(t, nodes, cluster.Nodes())
+
+	// node 1 leaves the cluster after its slots are migrated to node 0
+	fc.mutex.Lock()
+	fc.split = redisClusterSlots
+	fc.mutex.Unlock()
+
+	assert.Nil(t, cluster.loadSlots(ctx))
+
+	assert.Equal(t, []string{fc.addr(0)}, cluster.Nodes())
+
+	cluster.mutex.RLock()
+	_, ok := cluster.nodes[fc.addr(1)]
+	cluster.mutex.RUnlock()
+
+	assert.False(t, ok)
+}
+
+func TestRedisClusterRefreshInFlight(t *testing.T) {
+	fc := newFakeCluster(t, 8192)
+
+	cluster := newRedisCluster(newRedisSetting(fc.addr(0), WithRedisCluster()))
+
+	defer cluster.close()
+
+	ctx := context.Background()
+
+	assert.Nil(t, cluster.loadSlots(ctx))
+
+	// the pool of node 1 is looked up, and then closed by a refresh after node 1 leaves the cluster
+	pool := cluster.node(fc.addr(1))
+
+	fc.mutex.Lock()
+	fc.split = redisClusterSlots
+	fc.mutex.Unlock()
+
+	assert.Nil(t, cluster.loadSlots(ctx))
+
+	pool.close()
+
+	_, err := pool.Get(ctx)
+
+	assert.Equal(t, ErrRedisPoolClosed, err)
+
+	// a fresh pool is created for the redirect target
+	p, conn, err := cluster.nodeConn(ctx, fc.addr(1))
+
+	if assert.Nil(t, err) {
+		assert.NotEqual(t, pool, p)
+
+		p.Put(conn)
+	}
+
+	// the closed pool which is still in the nodes means the cluster is closed
+	cluster.mutex.Lock()
+	cluster.nodes[fc.addr(1)] = pool
+	cluster.mutex.Unlock()
+
+	_, _, err = cluster.nodeConn(ctx, fc.addr(1))
+
+	assert.Equal(t, ErrRedisPoolClosed, err)
+
+	cluster.mutex.Lock()
+	delete(cluster.nodes, fc.addr(1))
+	cluster.mutex.Unlock()
+
+	// the redirects to the stale node keep working while the topology changes
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 20; i++ {
+			fc.mutex.Lock()
+			fc.split = 8192 + (i%2)*8192
+			fc.mutex.Unlock()
+
+			cluster.loadSlots(ctx)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		_, err := cluster.doNode(ctx, fc.addr(i%2), false, "PING")
+
+		assert.Nil(t, err)
+	}
+
+	wg.Wait()
+}
+
+func TestRedisClusterDoTimeout(t *testing.T) {
+	fc := newFakeCluster(t, 8192)
+
+	// the nodes accept the command but never reply
+	for _, srv := range fc.nodes {
+		srv.Register("BLPOP", func(p *server.Peer, cmd string, args []string) {})
+	}
+
+	cluster := newRedisCluster(newRedisSetting(fc.addr(0), WithRedisCluster(), WithRedisReadTimeout(time.Minute)))
+
+	defer cluster.close()
+
+	assert.Nil(t, cluster.loadSlots(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := cluster.Do(ctx, "BLPOP", "a", 0)
+
+	assert.NotNil(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
+
+func TestClusterCommandKey(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		args []interface{}
+		key  string
+		ok   bool
+	}{
+		{"GET", []interface{}{"foo"}, "foo", true},
+		{"PING", nil, "", false},
+		{"EVAL", []interface{}{"return 1", 2, "{user:1}:a", "{user:1}:b", "arg"}, "{user:1}:a", true},
+		{"evalsha", []interface{}{"e0e1f9fabfc9d4800c877a703b823ac0578ff8db", "1", []byte("foo")}, "foo", true},
+		{"EVAL", []interface{}{"return 1", 0}, "", false},
+		{"XREAD", []interface{}{"COUNT", 10, "STREAMS", "orders", "$"}, "orders", true},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c", "BLOCK", 5000, "streams", "orders", ">"}, "orders", true},
+		{"XREADGROUP", []interface{}{"GROUP", "g", "c"}, "", false},
+	}
+
+	for _, c := range cases {
+		key, ok := clusterCommandKey(c.cmd, c.args)
+
+		assert.Equal(t, c.ok, ok, c.cmd)
+		assert.Equal(t, c.key, key, c.cmd)
+	}
+}
+
+func TestRedisClusterPreloadScripts(t *testing.T) {
+	fc := newFakeCluster(t, 8192)
+
+	assert.Nil(t, initRedisCluster("cluster_script", newRedisSetting(fc.addr(0), WithRedisCluster())))
+
+	defer func() {
+		RedisCluster("cluster_script").close()
+		redisClusterMap.Delete("cluster_script")
+	}()
+
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	for i := range fc.nodes {
+		assert.True(t, fc.scripts[i][testIncrScript.Hash()])
+		assert.True(t, fc.scripts[i][mutexUnlockScript.Hash()])
+	}
+}
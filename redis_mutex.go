@@ -0,0 +1,319 @@
+package yiigo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// ErrMutexNotHeld the mutex is not held by the owner (never acquired, released or expired).
+var ErrMutexNotHeld = errors.New("yiigo: redis mutex not held")
+
+// ErrMutexHeld the mutex is already acquired by itself, it should be unlocked before acquiring again.
+var ErrMutexHeld = errors.New("yiigo: redis mutex already held")
+
+var (
+	mutexUnlockScript = NewRedisScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+	mutexExtendScript = NewRedisScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+)
+
+type mutexSetting struct {
+	ttl           time.Duration
+	retryInterval time.Duration
+	maxRetryDelay time.Duration
+	autoExtend    bool
+}
+
+// MutexOption configures how we set up the redis mutex.
+type MutexOption func(s *mutexSetting)
+
+// WithMutexTTL specifies the expiration of the lock, default is 10s.
+func WithMutexTTL(ttl time.Duration) MutexOption {
+	return func(s *mutexSetting) {
+		s.ttl = ttl
+	}
+}
+
+// WithMutexRetry specifies the backoff for `Lock` retries,
+// the delay starts with interval and doubles each retry up to max, default is 50ms ~ 1s.
+func WithMutexRetry(interval, max time.Duration) MutexOption {
+	return func(s *mutexSetting) {
+		s.retryInterval = interval
+		s.maxRetryDelay = max
+	}
+}
+
+// WithMutexAutoExtend specifies extending the lease automatically (every ttl/3) while the lock is held.
+func WithMutexAutoExtend() MutexOption {
+	return func(s *mutexSetting) {
+		s.autoExtend = true
+	}
+}
+
+// RedisMutex a distributed lock based on redis.
+// The lock is acquired by `SET key token NX PX ttl` and released by a compare-and-delete lua script,
+// so that only the owner can release it.
+type RedisMutex struct {
+	pool    RedisPool
+	key     string
+	token   string
+	setting *mutexSetting
+	mutex   sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewRedisMutex returns a new redis mutex for the key.
+func NewRedisMutex(pool RedisPool, key string, options ...MutexOption) *RedisMutex {
+	m := &RedisMutex{
+		pool: pool,
+		key:  key,
+		setting: &mutexSetting{
+			ttl:           10 * time.Second,
+			retryInterval: 50 * time.Millisecond,
+			maxRetryDelay: time.Second,
+		},
+	}
+
+	for _, f := range options {
+		f(m.setting)
+	}
+
+	return m
+}
+
+// Key returns the key of the mutex.
+func (m *RedisMutex) Key() string {
+	return m.key
+}
+
+// Token returns the token which identifies the current owner, it is empty if the lock is not held.
+func (m *RedisMutex) Token() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.token
+}
+
+// TryLock tries to acquire the lock once, returns false if it's held by others,
+// and returns ErrMutexHeld if it's acquired by the mutex itself and not unlocked (even if expired).
+func (m *RedisMutex) TryLock(ctx context.Context) (bool, error) {
+	if len(m.Token()) != 0 {
+		return false, ErrMutexHeld
+	}
+
+	token, err := mutexToken()
+
+	if err != nil {
+		return false, err
+	}
+
+	conn, err := m.pool.Get(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer m.pool.Put(conn)
+
+	reply, err := redis.String(conn.do(ctx, "SET", m.key, token, "NX", "PX", m.setting.ttl.Milliseconds()))
+
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if reply != "OK" {
+		return false, nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// a concurrent TryLock acquired the lock which has expired, stop its keepalive
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+
+		m.stop, m.done = nil, nil
+	}
+
+	m.token = token
+
+	if m.setting.autoExtend {
+		m.stop = make(chan struct{})
+		m.done = make(chan struct{})
+
+		go m.keepalive(token, m.stop, m.done)
+	}
+
+	return true, nil
+}
+
+// Lock acquires the lock, it blocks and retries with backoff until the lock is acquired or ctx is done.
+func (m *RedisMutex) Lock(ctx context.Context) error {
+	delay := m.setting.retryInterval
+
+	for {
+		ok, err := m.TryLock(ctx)
+
+		if err != nil {
+			// the pool reports its own error when ctx is done
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		// jitter avoids the waiters retrying at the same time
+		timer := time.NewTimer(delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		delay = time.Duration(math.Min(float64(delay*2), float64(m.setting.maxRetryDelay)))
+	}
+}
+
+// Extend resets the expiration of the lock to ttl, returns ErrMutexNotHeld if the lock is lost.
+func (m *RedisMutex) Extend(ctx context.Context) error {
+	return m.extend(ctx, m.Token())
+}
+
+// Unlock releases the lock, returns ErrMutexNotHeld if the lock is not held by the owner.
+func (m *RedisMutex) Unlock(ctx context.Context) error {
+	m.mutex.Lock()
+
+	token := m.token
+	stop, done := m.stop, m.done
+
+	m.token = ""
+	m.stop, m.done = nil, nil
+
+	m.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	if len(token) == 0 {
+		return ErrMutexNotHeld
+	}
+
+	conn, err := m.pool.Get(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer m.pool.Put(conn)
+
+	n, err := redis.Int(mutexUnlockScript.DoConn(ctx, conn, m.key, token))
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrMutexNotHeld
+	}
+
+	return nil
+}
+
+func (m *RedisMutex) extend(ctx context.Context, token string) error {
+	if len(token) == 0 {
+		return ErrMutexNotHeld
+	}
+
+	conn, err := m.pool.Get(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer m.pool.Put(conn)
+
+	n, err := redis.Int(mutexExtendScript.DoConn(ctx, conn, m.key, token, m.setting.ttl.Milliseconds()))
+
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrMutexNotHeld
+	}
+
+	return nil
+}
+
+func (m *RedisMutex) keepalive(token string, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(m.setting.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), m.setting.ttl/3)
+
+			err := m.extend(ctx, token)
+
+			cancel()
+
+			if err != nil {
+				logger.Error("[yiigo] redis mutex extend error", zap.String("key", m.key), zap.Error(err))
+
+				if errors.Is(err, ErrMutexNotHeld) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func mutexToken() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,171 @@
+package yiigo
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutexOption(t *testing.T) {
+	setting := new(mutexSetting)
+
+	options := []MutexOption{
+		WithMutexTTL(5 * time.Second),
+		WithMutexRetry(10*time.Millisecond, 500*time.Millisecond),
+		WithMutexAutoExtend(),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &mutexSetting{
+		ttl:           5 * time.Second,
+		retryInterval: 10 * time.Millisecond,
+		maxRetryDelay: 500 * time.Millisecond,
+		autoExtend:    true,
+	}, setting)
+}
+
+func TestRedisMutex(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	m1 := NewRedisMutex(pool, "mutex", WithMutexTTL(time.Second))
+	m2 := NewRedisMutex(pool, "mutex", WithMutexTTL(time.Second), WithMutexRetry(5*time.Millisecond, 20*time.Millisecond))
+
+	ok, err := m1.TryLock(ctx)
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.NotEmpty(t, m1.Token())
+
+	v, _ := mr.Get("mutex")
+
+	assert.Equal(t, m1.Token(), v)
+	assert.Equal(t, time.Second, mr.TTL("mutex"))
+
+	ok, err = m2.TryLock(ctx)
+
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// others can't release it
+	assert.Equal(t, ErrMutexNotHeld, m2.Unlock(ctx))
+
+	// blocking acquire is canceled by ctx
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+
+	assert.Equal(t, context.DeadlineExceeded, m2.Lock(tctx))
+
+	cancel()
+
+	// blocking acquire succeeds after release
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+
+		assert.Nil(t, m1.Unlock(ctx))
+	}()
+
+	assert.Nil(t, m2.Lock(ctx))
+
+	v, _ = mr.Get("mutex")
+
+	assert.Equal(t, m2.Token(), v)
+
+	// expired
+	mr.FastForward(time.Second)
+
+	assert.Equal(t, ErrMutexNotHeld, m2.Extend(ctx))
+	assert.Equal(t, ErrMutexNotHeld, m2.Unlock(ctx))
+}
+
+func TestRedisMutexAutoExtend(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	m := NewRedisMutex(pool, "mutex", WithMutexTTL(300*time.Millisecond), WithMutexAutoExtend())
+
+	ok, err := m.TryLock(ctx)
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	mr.FastForward(250 * time.Millisecond)
+
+	assert.Equal(t, 50*time.Millisecond, mr.TTL("mutex"))
+
+	time.Sleep(150 * time.Millisecond)
+
+	assert.Equal(t, 300*time.Millisecond, mr.TTL("mutex"))
+
+	// acquiring again doesn't start another keepalive
+	ok, err = m.TryLock(ctx)
+
+	assert.Equal(t, ErrMutexHeld, err)
+	assert.False(t, ok)
+	assert.Equal(t, ErrMutexHeld, m.Lock(ctx))
+
+	assert.Nil(t, m.Unlock(ctx))
+	assert.False(t, mr.Exists("mutex"))
+
+	// the lock can be acquired again after unlock
+	ok, err = m.TryLock(ctx)
+
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, m.Unlock(ctx))
+
+	// no keepalive recreates or extends the lock
+	mr.Set("mutex", "other")
+	mr.SetTTL("mutex", 300*time.Millisecond)
+	mr.FastForward(250 * time.Millisecond)
+
+	time.Sleep(150 * time.Millisecond)
+
+	assert.Equal(t, 50*time.Millisecond, mr.TTL("mutex"))
+}
+
+func TestRedisMutexTimeout(t *testing.T) {
+	// a redis which accepts connections but never replies
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	pool := newRedis(ln.Addr().String())
+
+	defer pool.(redisCloser).close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+
+	defer cancel()
+
+	start := time.Now()
+
+	ok, err := NewRedisMutex(pool, "mutex").TryLock(ctx)
+
+	assert.NotNil(t, err)
+	assert.False(t, ok)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
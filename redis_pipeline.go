@@ -0,0 +1,287 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrRedisTxAborted the transaction is aborted because the watched keys are modified.
+var ErrRedisTxAborted = errors.New("yiigo: redis transaction aborted (watched keys modified)")
+
+// Pipeliner queues the commands of a pipeline.
+type Pipeliner interface {
+	// Send queues a command, it is sent when the pipeline is flushed.
+	Send(cmd string, args ...interface{})
+
+	// Len returns the number of the queued commands.
+	Len() int
+}
+
+type redisCmd struct {
+	name string
+	args []interface{}
+}
+
+type pipeliner struct {
+	cmds []*redisCmd
+}
+
+func (p *pipeliner) Send(cmd string, args ...interface{}) {
+	p.cmds = append(p.cmds, &redisCmd{name: cmd, args: args})
+}
+
+func (p *pipeliner) Len() int {
+	return len(p.cmds)
+}
+
+// RedisReply the reply of a pipelined command.
+type RedisReply struct {
+	Value interface{}
+	Err   error
+}
+
+// String converts the reply to string.
+func (r *RedisReply) String() (string, error) {
+	return redis.String(r.Value, r.Err)
+}
+
+// Bytes converts the reply to []byte.
+func (r *RedisReply) Bytes() ([]byte, error) {
+	return redis.Bytes(r.Value, r.Err)
+}
+
+// Int converts the reply to int.
+func (r *RedisReply) Int() (int, error) {
+	return redis.Int(r.Value, r.Err)
+}
+
+// Int64 converts the reply to int64.
+func (r *RedisReply) Int64() (int64, error) {
+	return redis.Int64(r.Value, r.Err)
+}
+
+// Float64 converts the reply to float64.
+func (r *RedisReply) Float64() (float64, error) {
+	return redis.Float64(r.Value, r.Err)
+}
+
+// Bool converts the reply to bool.
+func (r *RedisReply) Bool() (bool, error) {
+	return redis.Bool(r.Value, r.Err)
+}
+
+// Strings converts the reply to []string.
+func (r *RedisReply) Strings() ([]string, error) {
+	return redis.Strings(r.Value, r.Err)
+}
+
+// StringMap converts the reply to map[string]string.
+func (r *RedisReply) StringMap() (map[string]string, error) {
+	return redis.StringMap(r.Value, r.Err)
+}
+
+// Values converts the reply to []interface{}.
+func (r *RedisReply) Values() ([]interface{}, error) {
+	return redis.Values(r.Value, r.Err)
+}
+
+// Pipeline queues the commands by fn, sends them with one flush and returns the replies in order.
+// The error of each command is in its reply, the returned error is about fn or the connection.
+// Context with deadline can specify the timeout for receiving the replies.
+func (rc *RedisConn) Pipeline(ctx context.Context, fn func(p Pipeliner) error) ([]*RedisReply, error) {
+	p := new(pipeliner)
+
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+
+	if p.Len() == 0 {
+		return []*RedisReply{}, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range p.cmds {
+		if err := rc.Send(cmd.name, cmd.args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]*RedisReply, 0, p.Len())
+
+	for range p.cmds {
+		v, err := rc.receive(ctx)
+
+		// the connection is broken, the remaining replies are lost
+		if err != nil && rc.Err() != nil {
+			return nil, err
+		}
+
+		replies = append(replies, &RedisReply{Value: v, Err: err})
+	}
+
+	return replies, nil
+}
+
+type redisTxSetting struct {
+	watch   []string
+	retries int
+	backoff time.Duration
+}
+
+// RedisTxOption configures how we set up the redis transaction.
+type RedisTxOption func(s *redisTxSetting)
+
+// WithRedisTxWatch specifies the keys to WATCH before the transaction.
+func WithRedisTxWatch(keys ...string) RedisTxOption {
+	return func(s *redisTxSetting) {
+		s.watch = append(s.watch, keys...)
+	}
+}
+
+// WithRedisTxRetry specifies the retries when the watched keys are modified, the backoff is the delay between retries.
+func WithRedisTxRetry(retries int, backoff time.Duration) RedisTxOption {
+	return func(s *redisTxSetting) {
+		s.retries = retries
+		s.backoff = backoff
+	}
+}
+
+// RedisTxFunc the function of a redis transaction,
+// the watched values can be read by rc (eg: rc.Do("GET", key)) and the commands are queued by p.
+type RedisTxFunc func(rc *RedisConn, p Pipeliner) error
+
+// TxPipeline runs fn and executes the queued commands in MULTI/EXEC.
+// With `WithRedisTxWatch`, fn runs after WATCH and the transaction is retried from fn when the watched keys are modified,
+// it returns ErrRedisTxAborted when all retries are aborted.
+func (rc *RedisConn) TxPipeline(ctx context.Context, fn RedisTxFunc, options ...RedisTxOption) ([]*RedisReply, error) {
+	setting := new(redisTxSetting)
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	for i := 0; ; i++ {
+		replies, err := rc.txPipeline(ctx, fn, setting.watch)
+
+		if !errors.Is(err, ErrRedisTxAborted) || i >= setting.retries {
+			return replies, err
+		}
+
+		if setting.backoff > 0 {
+			timer := time.NewTimer(setting.backoff)
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+func (rc *RedisConn) txPipeline(ctx context.Context, fn RedisTxFunc, watch []string) ([]*RedisReply, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(watch) != 0 {
+		args := make([]interface{}, 0, len(watch))
+
+		for _, k := range watch {
+			args = append(args, k)
+		}
+
+		if _, err := rc.Do("WATCH", args...); err != nil {
+			return nil, err
+		}
+	}
+
+	p := new(pipeliner)
+
+	if err := fn(rc, p); err != nil {
+		if len(watch) != 0 {
+			rc.Do("UNWATCH")
+		}
+
+		return nil, err
+	}
+
+	if err := rc.Send("MULTI"); err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range p.cmds {
+		if err := rc.Send(cmd.name, cmd.args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rc.Send("EXEC"); err != nil {
+		return nil, err
+	}
+
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+
+	// MULTI + QUEUED...
+	for i := 0; i <= p.Len(); i++ {
+		if _, err := rc.receive(ctx); err != nil && rc.Err() != nil {
+			return nil, err
+		}
+	}
+
+	// the errors of queueing (eg: wrong number of arguments) abort the EXEC with EXECABORT
+	values, err := redis.Values(rc.receive(ctx))
+
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return nil, ErrRedisTxAborted
+		}
+
+		return nil, err
+	}
+
+	replies := make([]*RedisReply, 0, len(values))
+
+	for _, v := range values {
+		reply := &RedisReply{Value: v}
+
+		if e, ok := v.(redis.Error); ok {
+			reply.Value = nil
+			reply.Err = e
+		}
+
+		replies = append(replies, reply)
+	}
+
+	return replies, nil
+}
+
+// receive receives a reply, the deadline of ctx is the read timeout.
+func (rc *RedisConn) receive(ctx context.Context) (interface{}, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+
+		// 0 means no timeout, a deadline in the past fails the read and the broken conn is replaced by the pool
+		if timeout == 0 {
+			timeout = -1
+		}
+
+		return redis.ReceiveWithTimeout(rc.Conn, timeout)
+	}
+
+	return rc.Receive()
+}
@@ -0,0 +1,148 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisPipeline(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	conn, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	defer pool.Put(conn)
+
+	replies, err := conn.Pipeline(ctx, func(p Pipeliner) error {
+		for i := 0; i < 100; i++ {
+			p.Send("SET", fmt.Sprintf("key:%d", i), i)
+		}
+
+		p.Send("GET", "key:99")
+		p.Send("INCR", "key:99")
+		p.Send("HSET", "key:0", "field", "value")
+
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 103, len(replies))
+
+	v, err := replies[100].Int()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 99, v)
+
+	v, err = replies[101].Int()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 100, v)
+
+	// the error of a command is in its reply
+	assert.NotNil(t, replies[102].Err)
+
+	// nothing is sent when fn fails
+	replies, err = conn.Pipeline(ctx, func(p Pipeliner) error {
+		p.Send("SET", "key:0", "changed")
+
+		return errors.New("oops")
+	})
+
+	assert.NotNil(t, err)
+	assert.Nil(t, replies)
+
+	s, err := redis.String(conn.Do("GET", "key:0"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "0", s)
+}
+
+func TestRedisTxPipeline(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	conn, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	defer pool.Put(conn)
+
+	other, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	defer pool.Put(other)
+
+	_, err = conn.Do("SET", "balance", 100)
+
+	assert.Nil(t, err)
+
+	withdraw := func(times *int, modify bool) RedisTxFunc {
+		return func(rc *RedisConn, p Pipeliner) error {
+			*times++
+
+			balance, err := redis.Int(rc.Do("GET", "balance"))
+
+			if err != nil {
+				return err
+			}
+
+			// modified by others after WATCH
+			if modify && *times == 1 {
+				other.Do("INCRBY", "balance", 10)
+			}
+
+			p.Send("SET", "balance", balance-30)
+			p.Send("GET", "balance")
+
+			return nil
+		}
+	}
+
+	// aborted without retries
+	times := 0
+
+	_, err = conn.TxPipeline(ctx, withdraw(&times, true), WithRedisTxWatch("balance"))
+
+	assert.Equal(t, ErrRedisTxAborted, err)
+	assert.Equal(t, 1, times)
+
+	// retried
+	times = 0
+
+	replies, err := conn.TxPipeline(ctx, withdraw(&times, true), WithRedisTxWatch("balance"), WithRedisTxRetry(3, time.Millisecond))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, times)
+	assert.Equal(t, 2, len(replies))
+
+	balance, err := replies[1].Int()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 90, balance)
+
+	// queueing error aborts the transaction
+	_, err = conn.TxPipeline(ctx, func(rc *RedisConn, p Pipeliner) error {
+		p.Send("SET", "balance", 0)
+		p.Send("SET", "balance")
+
+		return nil
+	})
+
+	assert.NotNil(t, err)
+
+	balance, err = redis.Int(conn.Do("GET", "balance"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 90, balance)
+}
@@ -0,0 +1,209 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// RedisMessage the message received by `RedisSubscribe`.
+type RedisMessage struct {
+	// Pattern the matched pattern, it's empty for the channel subscriptions.
+	Pattern string
+	Channel string
+	Data    []byte
+}
+
+// errRedisSubClosed is returned when the server cancels all the subscriptions while ctx is not done.
+var errRedisSubClosed = errors.New("yiigo: redis subscription closed by server")
+
+// RedisSubHandler handles the messages of `RedisSubscribe`.
+type RedisSubHandler func(msg *RedisMessage)
+
+type redisSubSetting struct {
+	patterns     []string
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	pingInterval time.Duration
+}
+
+// RedisSubOption configures how we set up the redis subscription.
+type RedisSubOption func(s *redisSubSetting)
+
+// WithRedisSubPatterns specifies the patterns to subscribe (PSUBSCRIBE).
+func WithRedisSubPatterns(patterns ...string) RedisSubOption {
+	return func(s *redisSubSetting) {
+		s.patterns = append(s.patterns, patterns...)
+	}
+}
+
+// WithRedisSubBackoff specifies the backoff for resubscribing after disconnects,
+// the delay starts with min and doubles each time up to max, default is 100ms ~ 10s.
+func WithRedisSubBackoff(min, max time.Duration) RedisSubOption {
+	return func(s *redisSubSetting) {
+		s.minBackoff = min
+		s.maxBackoff = max
+	}
+}
+
+// WithRedisSubPingInterval specifies the interval of PING to detect the dead connections, default is 30s.
+func WithRedisSubPingInterval(d time.Duration) RedisSubOption {
+	return func(s *redisSubSetting) {
+		s.pingInterval = d
+	}
+}
+
+// RedisSubscribe subscribes the channels (and the patterns by `WithRedisSubPatterns`) of the named redis,
+// it blocks until ctx is done and returns nil.
+// The subscription uses a dedicated connection outside the pool, and it resubscribes with backoff after disconnects.
+// The panics of handler are recovered and logged.
+func RedisSubscribe(ctx context.Context, name string, channels []string, handler RedisSubHandler, options ...RedisSubOption) error {
+	setting := &redisSubSetting{
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   10 * time.Second,
+		pingInterval: 30 * time.Second,
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	if len(channels) == 0 && len(setting.patterns) == 0 {
+		return errors.New("yiigo: redis subscribe without channels")
+	}
+
+	rp, ok := Redis(name).(*redisPoolResource)
+
+	if !ok {
+		return fmt.Errorf("yiigo: redis.%s doesn't support subscribe", name)
+	}
+
+	backoff := setting.minBackoff
+
+	for {
+		subscribed, err := redisSubscribe(ctx, rp, channels, handler, setting)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if subscribed {
+			backoff = setting.minBackoff
+		}
+
+		logger.Error("[yiigo] redis subscribe error", zap.String("redis", name), zap.Error(err), zap.Duration("retry_after", backoff))
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > setting.maxBackoff {
+			backoff = setting.maxBackoff
+		}
+	}
+}
+
+// redisSubscribe subscribes until the connection is broken or ctx is done,
+// subscribed reports whether the subscription has been confirmed.
+func redisSubscribe(ctx context.Context, rp *redisPoolResource, channels []string, handler RedisSubHandler, setting *redisSubSetting) (subscribed bool, err error) {
+	rc, err := rp.dial()
+
+	if err != nil {
+		return false, err
+	}
+
+	defer rc.Conn.Close()
+
+	psc := redis.PubSubConn{Conn: rc.Conn}
+
+	if len(channels) != 0 {
+		if err = psc.Subscribe(redis.Args{}.AddFlat(channels)...); err != nil {
+			return false, err
+		}
+	}
+
+	if len(setting.patterns) != 0 {
+		if err = psc.PSubscribe(redis.Args{}.AddFlat(setting.patterns)...); err != nil {
+			return false, err
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(setting.pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				// the receiving returns when all the subscriptions are canceled,
+				// and the connection is closed if the server doesn't reply in time
+				psc.Unsubscribe()
+				psc.PUnsubscribe()
+
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					rc.Conn.Close()
+				}
+
+				return
+			case <-ticker.C:
+				if err := psc.Ping(""); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		// the PING replies keep the connection alive, it is broken when nothing is received in 2 ping intervals
+		switch v := psc.ReceiveWithTimeout(2 * setting.pingInterval).(type) {
+		case redis.Message:
+			handleRedisMessage(handler, &RedisMessage{
+				Pattern: v.Pattern,
+				Channel: v.Channel,
+				Data:    v.Data,
+			})
+		case redis.Subscription:
+			subscribed = true
+
+			if v.Count == 0 {
+				// canceled by the server, eg: a proxy
+				if ctx.Err() == nil {
+					return subscribed, errRedisSubClosed
+				}
+
+				return subscribed, nil
+			}
+		case redis.Pong:
+		case error:
+			return subscribed, v
+		}
+	}
+}
+
+func handleRedisMessage(handler RedisSubHandler, msg *RedisMessage) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("[yiigo] redis subscribe handler panic", zap.Any("error", r), zap.String("channel", msg.Channel), zap.ByteString("stack", debug.Stack()))
+		}
+	}()
+
+	handler(msg)
+}
@@ -0,0 +1,142 @@
+package yiigo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisSubOption(t *testing.T) {
+	setting := new(redisSubSetting)
+
+	options := []RedisSubOption{
+		WithRedisSubPatterns("cache:*"),
+		WithRedisSubBackoff(10*time.Millisecond, time.Second),
+		WithRedisSubPingInterval(time.Second),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &redisSubSetting{
+		patterns:     []string{"cache:*"},
+		minBackoff:   10 * time.Millisecond,
+		maxBackoff:   time.Second,
+		pingInterval: time.Second,
+	}, setting)
+}
+
+func TestRedisSubscribe(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	redisMap.Store("pubsub", pool)
+
+	defer redisMap.Delete("pubsub")
+
+	var (
+		mutex    sync.Mutex
+		messages []*RedisMessage
+	)
+
+	handler := func(msg *RedisMessage) {
+		if string(msg.Data) == "panic" {
+			panic("oops")
+		}
+
+		mutex.Lock()
+		messages = append(messages, msg)
+		mutex.Unlock()
+	}
+
+	received := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return len(messages)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+
+	go func() {
+		done <- RedisSubscribe(ctx, "pubsub", []string{"invalidate"}, handler,
+			WithRedisSubPatterns("cache:*"),
+			WithRedisSubBackoff(10*time.Millisecond, 50*time.Millisecond),
+		)
+	}()
+
+	subscribed := func() bool {
+		return mr.PubSubNumSub("invalidate")["invalidate"] == 1 && mr.PubSubNumPat() == 1
+	}
+
+	assert.Eventually(t, subscribed, time.Second, 10*time.Millisecond)
+
+	// the panic is recovered
+	mr.Publish("invalidate", "panic")
+	mr.Publish("invalidate", "user:1")
+	mr.Publish("cache:user", "user:2")
+
+	assert.Eventually(t, func() bool { return received() == 2 }, time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	assert.Equal(t, &RedisMessage{Channel: "invalidate", Data: []byte("user:1")}, messages[0])
+	assert.Equal(t, &RedisMessage{Pattern: "cache:*", Channel: "cache:user", Data: []byte("user:2")}, messages[1])
+	mutex.Unlock()
+
+	// resubscribed after the server restarts
+	mr.Close()
+
+	assert.Nil(t, mr.Restart())
+	assert.Eventually(t, subscribed, 2*time.Second, 10*time.Millisecond)
+
+	mr.Publish("invalidate", "user:3")
+
+	assert.Eventually(t, func() bool { return received() == 3 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber not stopped")
+	}
+}
+
+func TestRedisSubscribeClosed(t *testing.T) {
+	srv, err := server.NewServer("127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer srv.Close()
+
+	// the subscription is canceled right after it's confirmed
+	srv.Register("SUBSCRIBE", func(p *server.Peer, cmd string, args []string) {
+		p.WriteLen(3)
+		p.WriteBulk("subscribe")
+		p.WriteBulk(args[0])
+		p.WriteInt(1)
+
+		p.WriteLen(3)
+		p.WriteBulk("unsubscribe")
+		p.WriteBulk(args[0])
+		p.WriteInt(0)
+	})
+
+	pool := newRedis(srv.Addr().String())
+
+	defer pool.(redisCloser).close()
+
+	subscribed, err := redisSubscribe(context.Background(), pool.(*redisPoolResource), []string{"invalidate"}, func(msg *RedisMessage) {}, &redisSubSetting{pingInterval: time.Second})
+
+	assert.True(t, subscribed)
+	assert.Equal(t, errRedisSubClosed, err)
+}
@@ -0,0 +1,298 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrRateLimited the request is denied by the rate limiter.
+var ErrRateLimited = errors.New("yiigo: rate limited")
+
+var (
+	// KEYS[1] = key, ARGV = limit, window(ms), n
+	fixedWindowScript = NewRedisScript(1, `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+local ttl = redis.call("PTTL", KEYS[1])
+local fresh = ttl < 0
+
+if fresh then
+	ttl = window
+end
+
+if current + n > limit then
+	return {0, limit - current, ttl, ttl}
+end
+
+current = redis.call("INCRBY", KEYS[1], n)
+
+if fresh then
+	redis.call("PEXPIRE", KEYS[1], window)
+end
+
+return {1, limit - current, ttl, 0}
+`)
+
+	// KEYS[1] = key, ARGV = limit, window(ms), n, now(ms), member
+	slidingWindowScript = NewRedisScript(1, `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+
+local count = redis.call("ZCARD", KEYS[1])
+
+if count + n > limit then
+	local reset = window
+	local retry = window
+
+	local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+
+	if last[2] then
+		reset = tonumber(last[2]) + window - now
+	end
+
+	-- the request is allowed after the oldest (count + n - limit) entries expire
+	local idx = count + n - limit - 1
+	local entry = redis.call("ZRANGE", KEYS[1], idx, idx, "WITHSCORES")
+
+	if entry[2] then
+		retry = tonumber(entry[2]) + window - now
+	end
+
+	return {0, limit - count, reset, retry}
+end
+
+for i = 1, n do
+	redis.call("ZADD", KEYS[1], now, ARGV[5] .. ":" .. i)
+end
+
+redis.call("PEXPIRE", KEYS[1], window)
+
+return {1, limit - count - n, window, 0}
+`)
+
+	// KEYS[1] = key, ARGV = rate(tokens per second), burst, n, now(ms)
+	tokenBucketScript = NewRedisScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+-- the clocks of the clients may be skewed, never refill backwards
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+
+local allowed = 0
+local retry = 0
+
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) * 1000 / rate)
+end
+
+local reset = math.ceil((burst - tokens) * 1000 / rate)
+
+redis.call("HMSET", KEYS[1], "tokens", tokens, "ts", ts)
+redis.call("PEXPIRE", KEYS[1], math.max(reset, 1))
+
+return {allowed, math.floor(tokens), reset, retry}
+`)
+)
+
+// RateLimitResult the result of a rate limiter.
+type RateLimitResult struct {
+	Allowed bool
+
+	// Remaining the remaining quota after this request
+	Remaining int64
+
+	// ResetAfter the duration until the quota is fully restored
+	ResetAfter time.Duration
+
+	// RetryAfter the duration to wait before retrying, it's 0 if allowed
+	RetryAfter time.Duration
+}
+
+// RateLimiter the distributed rate limiter based on redis, the keys identify the limited subjects (eg: user id, ip).
+type RateLimiter interface {
+	// Allow reports whether one request of the key is allowed.
+	Allow(ctx context.Context, key string) (*RateLimitResult, error)
+
+	// AllowN reports whether n requests of the key are allowed at once.
+	AllowN(ctx context.Context, key string, n int64) (*RateLimitResult, error)
+}
+
+type rateLimitSetting struct {
+	prefix string
+}
+
+// RateLimitOption configures how we set up the rate limiter.
+type RateLimitOption func(s *rateLimitSetting)
+
+// WithRateLimitPrefix specifies the prefix of the redis keys, default is "ratelimit:".
+func WithRateLimitPrefix(prefix string) RateLimitOption {
+	return func(s *rateLimitSetting) {
+		s.prefix = prefix
+	}
+}
+
+type rateLimiter struct {
+	pool    RedisPool
+	script  *RedisScript
+	setting *rateLimitSetting
+	args    func(n int64, now time.Time) ([]interface{}, error)
+	now     func() time.Time
+}
+
+func (l *rateLimiter) Allow(ctx context.Context, key string) (*RateLimitResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *rateLimiter) AllowN(ctx context.Context, key string, n int64) (*RateLimitResult, error) {
+	args, err := l.args(n, l.now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := l.pool.Get(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer l.pool.Put(conn)
+
+	reply, err := redis.Int64s(l.script.DoConn(ctx, conn, append([]interface{}{l.setting.prefix + key}, args...)...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reply) != 4 {
+		return nil, errors.New("yiigo: unexpected rate limit reply")
+	}
+
+	result := &RateLimitResult{
+		Allowed:    reply[0] == 1,
+		Remaining:  reply[1],
+		ResetAfter: time.Duration(reply[2]) * time.Millisecond,
+		RetryAfter: time.Duration(reply[3]) * time.Millisecond,
+	}
+
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	return result, nil
+}
+
+func newRateLimiter(pool RedisPool, script *RedisScript, args func(n int64, now time.Time) ([]interface{}, error), options ...RateLimitOption) *rateLimiter {
+	l := &rateLimiter{
+		pool:    pool,
+		script:  script,
+		setting: &rateLimitSetting{prefix: "ratelimit:"},
+		args:    args,
+		now:     time.Now,
+	}
+
+	for _, f := range options {
+		f(l.setting)
+	}
+
+	return l
+}
+
+// NewFixedWindowLimiter returns a rate limiter which allows limit requests per window,
+// the window starts with the first request of the key.
+// It's the cheapest one, but allows up to 2*limit requests around the window boundary.
+func NewFixedWindowLimiter(pool RedisPool, limit int64, window time.Duration, options ...RateLimitOption) RateLimiter {
+	return newRateLimiter(pool, fixedWindowScript, func(n int64, now time.Time) ([]interface{}, error) {
+		return []interface{}{limit, window.Milliseconds(), n}, nil
+	}, options...)
+}
+
+// NewSlidingWindowLimiter returns a rate limiter which allows limit requests in any window (sliding log),
+// every allowed request is a member of a sorted set, so the memory grows with limit.
+// The timestamps come from the clients, keep their clocks in sync.
+func NewSlidingWindowLimiter(pool RedisPool, limit int64, window time.Duration, options ...RateLimitOption) RateLimiter {
+	return newRateLimiter(pool, slidingWindowScript, func(n int64, now time.Time) ([]interface{}, error) {
+		member, err := mutexToken()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []interface{}{limit, window.Milliseconds(), n, now.UnixNano() / int64(time.Millisecond), member}, nil
+	}, options...)
+}
+
+// NewTokenBucketLimiter returns a rate limiter with a bucket of burst tokens which is refilled by rate tokens per second,
+// each request takes one token.
+// The timestamps come from the clients, keep their clocks in sync.
+func NewTokenBucketLimiter(pool RedisPool, rate float64, burst int64, options ...RateLimitOption) RateLimiter {
+	return newRateLimiter(pool, tokenBucketScript, func(n int64, now time.Time) ([]interface{}, error) {
+		if rate <= 0 {
+			return nil, errors.New("yiigo: token bucket rate must be positive")
+		}
+
+		return []interface{}{rate, burst, n, now.UnixNano() / int64(time.Millisecond)}, nil
+	}, options...)
+}
+
+// RateLimitWait blocks until one request of the key is allowed or ctx is done.
+func RateLimitWait(ctx context.Context, limiter RateLimiter, key string) error {
+	for {
+		result, err := limiter.Allow(ctx, key)
+
+		if err != nil {
+			return err
+		}
+
+		if result.Allowed {
+			return nil
+		}
+
+		delay := result.RetryAfter
+
+		if delay <= 0 {
+			delay = 10 * time.Millisecond
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return ErrRateLimited
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
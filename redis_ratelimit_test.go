@@ -0,0 +1,200 @@
+package yiigo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitOption(t *testing.T) {
+	setting := new(rateLimitSetting)
+
+	options := []RateLimitOption{
+		WithRateLimitPrefix("rl:"),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &rateLimitSetting{prefix: "rl:"}, setting)
+}
+
+func TestFixedWindowLimiter(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	limiter := NewFixedWindowLimiter(pool, 3, time.Minute)
+
+	for i := int64(2); i >= 0; i-- {
+		result, err := limiter.Allow(ctx, "user:1")
+
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+		assert.Equal(t, time.Duration(0), result.RetryAfter)
+	}
+
+	assert.Equal(t, time.Minute, mr.TTL("ratelimit:user:1"))
+
+	result, err := limiter.Allow(ctx, "user:1")
+
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+
+	// the other keys are limited separately
+	result, err = limiter.AllowN(ctx, "user:2", 3)
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+
+	mr.FastForward(time.Minute)
+
+	result, err = limiter.Allow(ctx, "user:1")
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(2), result.Remaining)
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	now := time.Now()
+
+	limiter := NewSlidingWindowLimiter(pool, 3, 10*time.Second).(*rateLimiter)
+	limiter.now = func() time.Time { return now }
+
+	result, err := limiter.AllowN(ctx, "ip", 2)
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(1), result.Remaining)
+	assert.Equal(t, 10*time.Second, result.ResetAfter)
+
+	now = now.Add(4 * time.Second)
+
+	result, err = limiter.Allow(ctx, "ip")
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+
+	now = now.Add(time.Second)
+
+	result, err = limiter.Allow(ctx, "ip")
+
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+	assert.Equal(t, 5*time.Second, result.RetryAfter)
+	assert.Equal(t, 9*time.Second, result.ResetAfter)
+
+	// the first 2 requests slide out of the window
+	now = now.Add(5 * time.Second)
+
+	result, err = limiter.AllowN(ctx, "ip", 2)
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	now := time.Now()
+
+	limiter := NewTokenBucketLimiter(pool, 2, 4).(*rateLimiter)
+	limiter.now = func() time.Time { return now }
+
+	result, err := limiter.AllowN(ctx, "api", 4)
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+	assert.Equal(t, 2*time.Second, result.ResetAfter)
+
+	result, err = limiter.Allow(ctx, "api")
+
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	now = now.Add(time.Second)
+
+	result, err = limiter.Allow(ctx, "api")
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(1), result.Remaining)
+
+	// the bucket is never over filled
+	now = now.Add(time.Minute)
+
+	result, err = limiter.Allow(ctx, "api")
+
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(3), result.Remaining)
+
+	_, err = NewTokenBucketLimiter(pool, 0, 4).Allow(ctx, "api")
+
+	assert.NotNil(t, err)
+}
+
+func TestRateLimitWait(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	limiter := NewTokenBucketLimiter(pool, 20, 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		resp, err := HTTPGet(ctx, ts.URL, WithHTTPRateLimit(limiter, "outbound"))
+
+		assert.Nil(t, err)
+
+		resp.Body.Close()
+	}
+
+	// 1 burst + 2 refills of 50ms
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	limiter = NewFixedWindowLimiter(pool, 1, time.Minute)
+
+	actx, acancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer acancel()
+
+	assert.Nil(t, RateLimitWait(actx, limiter, "once"))
+
+	// the quota is retried after about a minute, beyond the deadline
+	wctx, wcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer wcancel()
+
+	start = time.Now()
+
+	assert.Equal(t, ErrRateLimited, RateLimitWait(wctx, limiter, "once"))
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
@@ -0,0 +1,129 @@
+package yiigo
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// the registered scripts (hash:keyCount => *RedisScript), they are preloaded into the named pools and cluster nodes by `Init`.
+// The pools never load them again, the servers which lose them (eg: restarts, failovers) are recovered by the EVAL fallback of `Do`.
+var redisScripts sync.Map
+
+// RedisScript a lua script which is called by EVALSHA, eg:
+//
+//	var incrScript = yiigo.NewRedisScript(1, `return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+//
+//	n, err := redis.Int64(incrScript.Do(ctx, yiigo.Redis(), "counter", 2))
+type RedisScript struct {
+	keyCount int
+	src      string
+	hash     string
+}
+
+// NewRedisScript returns a new script and registers it, keyCount is the number of the keys in keysAndArgs,
+// keyCount < 0 means the number is the first of keysAndArgs.
+// The scripts should be created at the package level, so that `Init` loads them into every named pool and cluster node.
+func NewRedisScript(keyCount int, src string) *RedisScript {
+	h := sha1.Sum([]byte(src))
+
+	s := &RedisScript{
+		keyCount: keyCount,
+		src:      src,
+		hash:     hex.EncodeToString(h[:]),
+	}
+
+	v, _ := redisScripts.LoadOrStore(s.hash+":"+fmt.Sprint(keyCount), s)
+
+	return v.(*RedisScript)
+}
+
+// Hash returns the SHA1 of the script.
+func (s *RedisScript) Hash() string {
+	return s.hash
+}
+
+// Load loads the script into the redis of the pool by SCRIPT LOAD.
+func (s *RedisScript) Load(ctx context.Context, pool RedisPool) error {
+	conn, err := pool.Get(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Put(conn)
+
+	return s.load(ctx, conn)
+}
+
+// Do evaluates the script by EVALSHA with a connection of the pool,
+// it falls back to EVAL (which also caches the script) if the script is not loaded, eg: after failovers or restarts.
+// The scripts are only preloaded by `Init` and are not reloaded when the pool redials, this fallback is the only recovery,
+// since the script cache is shared by all the connections of a server, only the first call after the loss pays for EVAL.
+func (s *RedisScript) Do(ctx context.Context, pool RedisPool, keysAndArgs ...interface{}) (interface{}, error) {
+	conn, err := pool.Get(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer pool.Put(conn)
+
+	return s.DoConn(ctx, conn, keysAndArgs...)
+}
+
+// DoConn evaluates the script by EVALSHA with the connection, it falls back to EVAL if the script is not loaded.
+func (s *RedisScript) DoConn(ctx context.Context, conn *RedisConn, keysAndArgs ...interface{}) (interface{}, error) {
+	reply, err := conn.do(ctx, "EVALSHA", s.args(s.hash, keysAndArgs)...)
+
+	var e redis.Error
+
+	if errors.As(err, &e) && strings.HasPrefix(string(e), "NOSCRIPT ") {
+		return conn.do(ctx, "EVAL", s.args(s.src, keysAndArgs)...)
+	}
+
+	return reply, err
+}
+
+func (s *RedisScript) load(ctx context.Context, conn *RedisConn) error {
+	hash, err := redis.String(conn.do(ctx, "SCRIPT", "LOAD", s.src))
+
+	if err != nil {
+		return err
+	}
+
+	if hash != s.hash {
+		return fmt.Errorf("yiigo: unexpected script hash %s (want %s)", hash, s.hash)
+	}
+
+	return nil
+}
+
+func (s *RedisScript) args(spec string, keysAndArgs []interface{}) []interface{} {
+	if s.keyCount < 0 {
+		return append([]interface{}{spec}, keysAndArgs...)
+	}
+
+	return append([]interface{}{spec, s.keyCount}, keysAndArgs...)
+}
+
+// loadRedisScripts loads all the registered scripts with the connection, it's only called by `Init`,
+// the failures are logged, and the scripts are loaded by EVAL when they're called.
+func loadRedisScripts(name string, conn *RedisConn) {
+	redisScripts.Range(func(key, value interface{}) bool {
+		s := value.(*RedisScript)
+
+		if err := s.load(context.TODO(), conn); err != nil {
+			logger.Error("[yiigo] redis script load error", zap.String("redis", name), zap.String("hash", s.hash), zap.Error(err))
+		}
+
+		return true
+	})
+}
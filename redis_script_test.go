@@ -0,0 +1,139 @@
+package yiigo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+var testIncrScript = NewRedisScript(1, `return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+
+func TestNewRedisScript(t *testing.T) {
+	// the same script is registered once
+	assert.Same(t, testIncrScript, NewRedisScript(1, `return redis.call("INCRBY", KEYS[1], ARGV[1])`))
+	assert.NotSame(t, testIncrScript, NewRedisScript(-1, `return redis.call("INCRBY", KEYS[1], ARGV[1])`))
+
+	assert.Equal(t, "e0e1f9fabfc9d4800c877a703b823ac0578ff8db", NewRedisScript(0, `return 1`).Hash())
+}
+
+func TestRedisScript(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	// NOSCRIPT falls back to EVAL
+	n, err := redis.Int64(testIncrScript.Do(ctx, pool, "counter", 2))
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	assert.Nil(t, testIncrScript.Load(ctx, pool))
+
+	conn, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	exists, err := redis.Ints(conn.Do("SCRIPT", "EXISTS", testIncrScript.Hash()))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, exists)
+
+	pool.Put(conn)
+
+	n, err = redis.Int64(testIncrScript.Do(ctx, pool, "counter", 3))
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+
+	// the number of keys is the first argument
+	n, err = redis.Int64(NewRedisScript(-1, `return #KEYS + #ARGV`).Do(ctx, pool, 2, "a", "b", "c"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	// the script errors are returned
+	_, err = NewRedisScript(0, `return redis.call("INCR")`).Do(ctx, pool)
+
+	assert.NotNil(t, err)
+}
+
+func TestRedisScriptPreload(t *testing.T) {
+	mr, err := miniredis.Run()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mr.Close()
+
+	assert.Nil(t, initRedis("script", mr.Addr()))
+
+	pool := Redis("script")
+
+	defer func() {
+		redisMap.Delete("script")
+		pool.(redisCloser).close()
+	}()
+
+	conn, err := pool.Get(context.Background())
+
+	assert.Nil(t, err)
+
+	defer pool.Put(conn)
+
+	exists, err := redis.Ints(conn.Do("SCRIPT", "EXISTS", testIncrScript.Hash(), mutexUnlockScript.Hash()))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 1}, exists)
+}
+
+func TestRedisScriptRedial(t *testing.T) {
+	mr, pool := newTestRedis(t)
+
+	ctx := context.Background()
+
+	assert.Nil(t, testIncrScript.Load(ctx, pool))
+
+	// the server restarts and loses the scripts
+	mr.Close()
+
+	assert.Nil(t, mr.Restart())
+
+	conn, err := redis.Dial("tcp", mr.Addr())
+
+	assert.Nil(t, err)
+
+	_, err = conn.Do("SCRIPT", "FLUSH")
+
+	assert.Nil(t, err)
+
+	conn.Close()
+
+	// a broken connection fails and is redialed by the pool,
+	// the script isn't reloaded after the redial, EVALSHA falls back to EVAL
+	var n int64
+
+	assert.Eventually(t, func() bool {
+		n, err = redis.Int64(testIncrScript.Do(ctx, pool, "redial", 2))
+
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, int64(2), n)
+
+	// the fallback caches the script for all the connections of the server
+	conn, err = redis.Dial("tcp", mr.Addr())
+
+	assert.Nil(t, err)
+
+	defer conn.Close()
+
+	exists, err := redis.Ints(conn.Do("SCRIPT", "EXISTS", testIncrScript.Hash()))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, exists)
+}
@@ -0,0 +1,128 @@
+package yiigo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+type sentinelSetting struct {
+	master        string
+	addrs         []string
+	checkInterval time.Duration
+}
+
+// WithRedisSentinel specifies the sentinels for redis, the master is discovered by asking the sentinels in order,
+// and the address of `WithRedis` is ignored.
+// The sentinels are checked periodically (see `WithRedisSentinelCheckInterval`),
+// when the master changes, the connections to the old one are closed and redialed.
+func WithRedisSentinel(masterName string, sentinelAddrs ...string) RedisOption {
+	return func(s *redisSetting) {
+		if s.sentinel == nil {
+			s.sentinel = new(sentinelSetting)
+		}
+
+		s.sentinel.master = masterName
+		s.sentinel.addrs = sentinelAddrs
+	}
+}
+
+// WithRedisSentinelCheckInterval specifies the interval of checking the sentinels for the master switch, default: 1s.
+// It only takes effect with `WithRedisSentinel`.
+func WithRedisSentinelCheckInterval(t time.Duration) RedisOption {
+	return func(s *redisSetting) {
+		if s.sentinel == nil {
+			s.sentinel = new(sentinelSetting)
+		}
+
+		s.sentinel.checkInterval = t
+	}
+}
+
+// discoverMaster asks the sentinels for the current master address and records it.
+func (r *redisPoolResource) discoverMaster() (string, error) {
+	var lastErr error
+
+	for _, addr := range r.config.sentinel.addrs {
+		master, err := r.sentinelMaster(addr)
+
+		if err != nil {
+			lastErr = err
+
+			continue
+		}
+
+		if prev, _ := r.master.Load().(string); prev != master {
+			r.master.Store(master)
+
+			if len(prev) != 0 {
+				logger.Info("[yiigo] redis master switched", zap.String("master", r.config.sentinel.master), zap.String("from", prev), zap.String("to", master))
+			}
+		}
+
+		return master, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no sentinel")
+	}
+
+	return "", fmt.Errorf("yiigo: redis master %s not found: %w", r.config.sentinel.master, lastErr)
+}
+
+func (r *redisPoolResource) sentinelMaster(addr string) (string, error) {
+	conn, err := redis.Dial("tcp", addr,
+		redis.DialConnectTimeout(r.config.connTimeout),
+		redis.DialReadTimeout(r.config.readTimeout),
+		redis.DialWriteTimeout(r.config.writeTimeout),
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", r.config.sentinel.master))
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(reply) != 2 {
+		return "", fmt.Errorf("sentinel %s: unexpected reply %v", addr, reply)
+	}
+
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+// isStale reports whether the connection points at a master which has been demoted.
+func (r *redisPoolResource) isStale(rc *RedisConn) bool {
+	if r.config.sentinel == nil {
+		return false
+	}
+
+	master, _ := r.master.Load().(string)
+
+	return rc.addr != master
+}
+
+func (r *redisPoolResource) watchMaster(stop chan struct{}) {
+	ticker := time.NewTicker(r.config.sentinel.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := r.discoverMaster(); err != nil {
+				logger.Error("[yiigo] redis sentinel error", zap.Error(err))
+			}
+		}
+	}
+}
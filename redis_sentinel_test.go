@@ -0,0 +1,243 @@
+package yiigo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSentinel a sentinel speaking RESP which only answers `SENTINEL get-master-addr-by-name`.
+type fakeSentinel struct {
+	listener net.Listener
+	master   string
+	mutex    sync.Mutex
+}
+
+func newFakeSentinel(t *testing.T, master string) *fakeSentinel {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeSentinel{
+		listener: l,
+		master:   master,
+	}
+
+	go s.serve()
+
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	return s
+}
+
+func (s *fakeSentinel) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeSentinel) SetMaster(master string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.master = master
+}
+
+func (s *fakeSentinel) serve() {
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSentinel) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readRESPArray(r)
+
+		if err != nil {
+			return
+		}
+
+		if len(args) == 3 && strings.EqualFold(args[0], "SENTINEL") && args[1] == "get-master-addr-by-name" && args[2] == "mymaster" {
+			s.mutex.Lock()
+			host, port, _ := net.SplitHostPort(s.master)
+			s.mutex.Unlock()
+
+			fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+
+			continue
+		}
+
+		fmt.Fprint(conn, "*-1\r\n")
+	}
+}
+
+func readRESPArray(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		if _, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+
+		arg, err := r.ReadString('\n')
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, strings.TrimSpace(arg))
+	}
+
+	return args, nil
+}
+
+func TestRedisSentinelOption(t *testing.T) {
+	setting := newRedisSetting("", WithRedisSentinel("mymaster", "127.0.0.1:26379", "127.0.0.1:26380"))
+
+	assert.Equal(t, &sentinelSetting{
+		master:        "mymaster",
+		addrs:         []string{"127.0.0.1:26379", "127.0.0.1:26380"},
+		checkInterval: time.Second,
+	}, setting.sentinel)
+
+	// the options in any order
+	setting = newRedisSetting("", WithRedisSentinelCheckInterval(100*time.Millisecond), WithRedisSentinel("mymaster", "127.0.0.1:26379"))
+
+	assert.Equal(t, &sentinelSetting{
+		master:        "mymaster",
+		addrs:         []string{"127.0.0.1:26379"},
+		checkInterval: 100 * time.Millisecond,
+	}, setting.sentinel)
+
+	// without sentinels
+	assert.Nil(t, newRedisSetting("127.0.0.1:6379", WithRedisSentinelCheckInterval(time.Second)).sentinel)
+}
+
+func TestRedisSentinel(t *testing.T) {
+	mr1, _ := newTestRedis(t)
+	mr2, _ := newTestRedis(t)
+
+	mr1.Set("node", "1")
+	mr2.Set("node", "2")
+
+	sentinel := newFakeSentinel(t, mr1.Addr())
+
+	// the first sentinel is down
+	pool := newRedis("", WithRedisSentinel("mymaster", "127.0.0.1:1", sentinel.Addr()), WithRedisPool(WithPoolSize(1)))
+
+	defer pool.(redisCloser).close()
+
+	rp := pool.(*redisPoolResource)
+
+	ctx := context.Background()
+
+	conn, err := pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	node, err := redis.String(conn.Do("GET", "node"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1", node)
+
+	pool.Put(conn)
+
+	// failover
+	sentinel.SetMaster(mr2.Addr())
+
+	_, err = rp.discoverMaster()
+
+	assert.Nil(t, err)
+
+	conn, err = pool.Get(ctx)
+
+	assert.Nil(t, err)
+
+	node, err = redis.String(conn.Do("GET", "node"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "2", node)
+
+	pool.Put(conn)
+
+	// unknown master
+	unknown := &redisPoolResource{config: new(redisSetting)}
+
+	WithRedisSentinel("unknown", sentinel.Addr())(unknown.config)
+
+	_, err = unknown.discoverMaster()
+
+	assert.NotNil(t, err)
+}
+
+func TestRedisSentinelWatchMaster(t *testing.T) {
+	mr1, _ := newTestRedis(t)
+	mr2, _ := newTestRedis(t)
+
+	mr1.Set("node", "1")
+	mr2.Set("node", "2")
+
+	sentinel := newFakeSentinel(t, mr1.Addr())
+
+	pool := newRedis("", WithRedisSentinel("mymaster", sentinel.Addr()), WithRedisSentinelCheckInterval(10*time.Millisecond), WithRedisPool(WithPoolSize(1)))
+
+	defer pool.(redisCloser).close()
+
+	ctx := context.Background()
+
+	node := func() string {
+		conn, err := pool.Get(ctx)
+
+		if err != nil {
+			return ""
+		}
+
+		defer pool.Put(conn)
+
+		v, _ := redis.String(conn.Do("GET", "node"))
+
+		return v
+	}
+
+	assert.Equal(t, "1", node())
+
+	// the idle connection to the old master is replaced after the watcher sees the failover
+	sentinel.SetMaster(mr2.Addr())
+
+	assert.Eventually(t, func() bool {
+		return node() == "2"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,699 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+var (
+	redisStreamWorkers []*RedisStreamWorker
+	redisStreamMutex   sync.Mutex
+)
+
+// RedisStreamMessage the message of a redis stream.
+type RedisStreamMessage struct {
+	Stream string
+	ID     string
+	Values map[string]string
+
+	// Deliveries the number of times the message has been delivered, starts with 1
+	Deliveries int64
+}
+
+// RedisStreamConsumer redis stream consumer, the messages are acknowledged (XACK) when HandleMessage returns nil,
+// otherwise they are redelivered after the claim idle time.
+type RedisStreamConsumer interface {
+	HandleMessage(msg *RedisStreamMessage) error
+	Stream() string
+	Group() string
+
+	// MaxDeliveries the messages are moved to the dead-letter stream after max deliveries, default: 5
+	MaxDeliveries() int64
+}
+
+type redisStreamSetting struct {
+	consumer      string
+	batch         int
+	block         time.Duration
+	claimIdle     time.Duration
+	claimInterval time.Duration
+	deadLetter    string
+	startID       string
+}
+
+// RedisStreamOption configures how we set up the redis stream worker.
+type RedisStreamOption func(s *redisStreamSetting)
+
+// WithRedisStreamConsumerName specifies the consumer name in the group, default is "hostname-pid".
+func WithRedisStreamConsumerName(name string) RedisStreamOption {
+	return func(s *redisStreamSetting) {
+		s.consumer = name
+	}
+}
+
+// WithRedisStreamBatch specifies the max number of the messages for each read (COUNT), default is 10.
+func WithRedisStreamBatch(n int) RedisStreamOption {
+	return func(s *redisStreamSetting) {
+		s.batch = n
+	}
+}
+
+// WithRedisStreamBlock specifies the block timeout of XREADGROUP, default is 5s.
+// `Stop` waits for the blocking read, so don't make it too long.
+func WithRedisStreamBlock(d time.Duration) RedisStreamOption {
+	return func(s *redisStreamSetting) {
+		s.block = d
+	}
+}
+
+// WithRedisStreamClaim specifies the pending messages which have been idle for minIdle are claimed and redelivered,
+// they are checked every interval, default is 1m and 30s.
+func WithRedisStreamClaim(minIdle, interval time.Duration) RedisStreamOption {
+	return func(s *redisStreamSetting) {
+		s.claimIdle = minIdle
+		s.claimInterval = interval
+	}
+}
+
+// WithRedisStreamDeadLetter specifies the dead-letter stream, default is "<stream>:dead".
+func WithRedisStreamDeadLetter(stream string) RedisStreamOption {
+	return func(s *redisStreamSetting) {
+		s.deadLetter = stream
+	}
+}
+
+// WithRedisStreamStartID specifies the ID from which the group is created, default is "$" (the new messages).
+func WithRedisStreamStartID(id string) RedisStreamOption {
+	return func(s *redisStreamSetting) {
+		s.startID = id
+	}
+}
+
+// RedisStreamWorker the consumer-group worker of a redis stream.
+type RedisStreamWorker struct {
+	name     string
+	pool     RedisPool
+	consumer RedisStreamConsumer
+	setting  *redisStreamSetting
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	// mutex guards started
+	mutex   sync.Mutex
+	started bool
+
+	// inflight the IDs of the messages which are read but not handled yet, the claims skip them
+	inflight sync.Map
+}
+
+// NewRedisStreamWorker returns a new worker of the consumer on the named redis.
+func NewRedisStreamWorker(name string, consumer RedisStreamConsumer, options ...RedisStreamOption) *RedisStreamWorker {
+	hostname, _ := os.Hostname()
+
+	w := &RedisStreamWorker{
+		name:     name,
+		pool:     Redis(name),
+		consumer: consumer,
+		setting: &redisStreamSetting{
+			consumer:      fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+			batch:         10,
+			block:         5 * time.Second,
+			claimIdle:     time.Minute,
+			claimInterval: 30 * time.Second,
+			deadLetter:    consumer.Stream() + ":dead",
+			startID:       "$",
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	for _, f := range options {
+		f(w.setting)
+	}
+
+	return w
+}
+
+// Start creates the group (XGROUP CREATE MKSTREAM) if not exists and starts consuming in background,
+// the started workers are stopped by `Shutdown`. A worker can only be started once.
+func (w *RedisStreamWorker) Start(ctx context.Context) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.started {
+		return errors.New("yiigo: redis stream worker already started")
+	}
+
+	if w.stopped() {
+		return errors.New("yiigo: redis stream worker already stopped")
+	}
+
+	if err := w.createGroup(ctx); err != nil {
+		return err
+	}
+
+	w.started = true
+
+	redisStreamMutex.Lock()
+	redisStreamWorkers = append(redisStreamWorkers, w)
+	redisStreamMutex.Unlock()
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		w.readLoop()
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		w.claimLoop()
+	}()
+
+	go func() {
+		wg.Wait()
+		close(w.done)
+	}()
+
+	return nil
+}
+
+// Stop stops the started worker and waits for the in-flight messages, or returns ctx.Err() if ctx is done first.
+// It returns nil immediately if the worker has never been started.
+func (w *RedisStreamWorker) Stop(ctx context.Context) error {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+
+	w.mutex.Lock()
+	started := w.started
+	w.mutex.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *RedisStreamWorker) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d, returns false if the worker is stopped.
+func (w *RedisStreamWorker) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-w.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (w *RedisStreamWorker) createGroup(ctx context.Context) error {
+	conn, err := w.pool.Get(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer w.pool.Put(conn)
+
+	_, err = conn.do(ctx, "XGROUP", "CREATE", w.consumer.Stream(), w.consumer.Group(), w.setting.startID, "MKSTREAM")
+
+	// the group already exists
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+
+	return err
+}
+
+func (w *RedisStreamWorker) readLoop() {
+	for !w.stopped() {
+		msgs, err := w.read()
+
+		if err != nil {
+			logger.Error("[yiigo] redis stream read error", zap.String("redis", w.name), zap.String("stream", w.consumer.Stream()), zap.Error(err))
+
+			// the group is removed, eg: the stream is deleted
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				if err = w.createGroup(context.Background()); err != nil {
+					logger.Error("[yiigo] redis stream create group error", zap.String("redis", w.name), zap.String("stream", w.consumer.Stream()), zap.Error(err))
+				}
+			}
+
+			if !w.sleep(time.Second) {
+				return
+			}
+
+			continue
+		}
+
+		// the messages waiting in the batch become idle too
+		for _, msg := range msgs {
+			w.inflight.Store(msg.ID, struct{}{})
+		}
+
+		for _, msg := range msgs {
+			// the remaining messages are pending and will be claimed
+			if w.stopped() {
+				return
+			}
+
+			w.handle(msg)
+
+			w.inflight.Delete(msg.ID)
+		}
+	}
+}
+
+func (w *RedisStreamWorker) read() ([]*RedisStreamMessage, error) {
+	conn, err := w.pool.Get(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer w.pool.Put(conn)
+
+	reply, err := redis.Values(redis.DoWithTimeout(conn.Conn, w.setting.block+time.Second, "XREADGROUP",
+		"GROUP", w.consumer.Group(), w.setting.consumer,
+		"COUNT", w.setting.batch,
+		"BLOCK", w.setting.block.Milliseconds(),
+		"STREAMS", w.consumer.Stream(), ">",
+	))
+
+	if err != nil {
+		// block timeout
+		if errors.Is(err, redis.ErrNil) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	msgs := make([]*RedisStreamMessage, 0)
+
+	for _, v := range reply {
+		var stream []interface{}
+
+		if stream, err = redis.Values(v, nil); err != nil || len(stream) != 2 {
+			return nil, fmt.Errorf("yiigo: unexpected XREADGROUP reply: %v", v)
+		}
+
+		entries, err := redisStreamEntries(stream[1], 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		msgs = append(msgs, entries...)
+	}
+
+	for _, msg := range msgs {
+		msg.Stream = w.consumer.Stream()
+	}
+
+	return msgs, nil
+}
+
+func (w *RedisStreamWorker) handle(msg *RedisStreamMessage) {
+	if err := w.handleMessage(msg); err != nil {
+		logger.Error("[yiigo] redis stream handle error", zap.String("stream", msg.Stream), zap.String("id", msg.ID), zap.Int64("deliveries", msg.Deliveries), zap.Error(err))
+
+		return
+	}
+
+	if err := w.ack(msg.ID); err != nil {
+		logger.Error("[yiigo] redis stream ack error", zap.String("stream", msg.Stream), zap.String("id", msg.ID), zap.Error(err))
+	}
+}
+
+func (w *RedisStreamWorker) handleMessage(msg *RedisStreamMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("yiigo: redis stream handler panic: %v", r)
+
+			logger.Error("[yiigo] redis stream handler panic", zap.Any("error", r), zap.String("stream", msg.Stream), zap.ByteString("stack", debug.Stack()))
+		}
+	}()
+
+	return w.consumer.HandleMessage(msg)
+}
+
+func (w *RedisStreamWorker) ack(ids ...interface{}) error {
+	conn, err := w.pool.Get(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	defer w.pool.Put(conn)
+
+	_, err = conn.Do("XACK", redis.Args{w.consumer.Stream(), w.consumer.Group()}.Add(ids...)...)
+
+	return err
+}
+
+func (w *RedisStreamWorker) claimLoop() {
+	for w.sleep(w.setting.claimInterval) {
+		if err := w.claim(); err != nil {
+			logger.Error("[yiigo] redis stream claim error", zap.String("redis", w.name), zap.String("stream", w.consumer.Stream()), zap.Error(err))
+		}
+	}
+}
+
+// claim checks the pending messages (XPENDING) page by page, the ones in flight of this worker are skipped,
+// the idle ones are moved to the dead-letter stream if they reach the max deliveries, otherwise claimed (XCLAIM) and handled.
+func (w *RedisStreamWorker) claim() error {
+	maxDeliveries := w.consumer.MaxDeliveries()
+
+	if maxDeliveries <= 0 {
+		maxDeliveries = 5
+	}
+
+	start := "-"
+
+	for !w.stopped() {
+		pending, err := w.pending(start)
+
+		if err != nil {
+			return err
+		}
+
+		for _, p := range pending {
+			if w.stopped() {
+				return nil
+			}
+
+			if p.idle < w.setting.claimIdle {
+				continue
+			}
+
+			// still being handled by the read loop
+			if _, ok := w.inflight.Load(p.id); ok {
+				continue
+			}
+
+			if p.deliveries >= maxDeliveries {
+				if err = w.deadLetter(p.id, p.deliveries); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			msg, err := w.claimMessage(p.id)
+
+			if err != nil {
+				return err
+			}
+
+			// claimed by others
+			if msg == nil {
+				continue
+			}
+
+			w.handle(msg)
+		}
+
+		if len(pending) < w.setting.batch {
+			return nil
+		}
+
+		if start, err = nextRedisStreamID(pending[len(pending)-1].id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type redisStreamPending struct {
+	id         string
+	idle       time.Duration
+	deliveries int64
+}
+
+func (w *RedisStreamWorker) pending(start string) ([]*redisStreamPending, error) {
+	conn, err := w.pool.Get(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer w.pool.Put(conn)
+
+	reply, err := redis.Values(conn.Do("XPENDING", w.consumer.Stream(), w.consumer.Group(), start, "+", w.setting.batch))
+
+	if err != nil {
+		if errors.Is(err, redis.ErrNil) {
+			return []*redisStreamPending{}, nil
+		}
+
+		return nil, err
+	}
+
+	pending := make([]*redisStreamPending, 0, len(reply))
+
+	for _, v := range reply {
+		var (
+			id         string
+			consumer   string
+			idle       int64
+			deliveries int64
+		)
+
+		fields, err := redis.Values(v, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = redis.Scan(fields, &id, &consumer, &idle, &deliveries); err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, &redisStreamPending{
+			id:         id,
+			idle:       time.Duration(idle) * time.Millisecond,
+			deliveries: deliveries,
+		})
+	}
+
+	return pending, nil
+}
+
+// claimMessage claims the message if it's still idle, returns nil if it's claimed by others or deleted.
+func (w *RedisStreamWorker) claimMessage(id string) (*RedisStreamMessage, error) {
+	conn, err := w.pool.Get(context.Background())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer w.pool.Put(conn)
+
+	// XCLAIM increments the delivery count
+	reply, err := conn.Do("XCLAIM", w.consumer.Stream(), w.consumer.Group(), w.setting.consumer, w.setting.claimIdle.Milliseconds(), id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := redisStreamEntries(reply, 0)
+
+	if err != nil || len(msgs) == 0 {
+		return nil, err
+	}
+
+	msg := msgs[0]
+
+	// the message is deleted (XDEL or trimmed)
+	if msg.Values == nil {
+		return nil, w.ack(id)
+	}
+
+	msg.Stream = w.consumer.Stream()
+
+	pending, err := w.pending(id)
+
+	if err == nil && len(pending) != 0 && pending[0].id == id {
+		msg.Deliveries = pending[0].deliveries
+	}
+
+	return msg, nil
+}
+
+// deadLetter moves the message to the dead-letter stream with the source info, and acknowledges it.
+func (w *RedisStreamWorker) deadLetter(id string, deliveries int64) error {
+	conn, err := w.pool.Get(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	defer w.pool.Put(conn)
+
+	reply, err := conn.Do("XRANGE", w.consumer.Stream(), id, id)
+
+	if err != nil {
+		return err
+	}
+
+	msgs, err := redisStreamEntries(reply, deliveries)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.TxPipeline(context.Background(), func(rc *RedisConn, p Pipeliner) error {
+		// the message is deleted, just acknowledge it
+		if len(msgs) != 0 && msgs[0].Values != nil {
+			args := redis.Args{w.setting.deadLetter, "*"}
+
+			for k, v := range msgs[0].Values {
+				args = args.Add(k, v)
+			}
+
+			args = args.Add("_stream", w.consumer.Stream(), "_group", w.consumer.Group(), "_id", id, "_deliveries", deliveries)
+
+			p.Send("XADD", args...)
+		}
+
+		p.Send("XACK", w.consumer.Stream(), w.consumer.Group(), id)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	logger.Warn("[yiigo] redis stream message dead", zap.String("stream", w.consumer.Stream()), zap.String("id", id), zap.Int64("deliveries", deliveries), zap.String("dead_letter", w.setting.deadLetter))
+
+	return nil
+}
+
+// redisStreamEntries parses the stream entries: [[id, [field, value, ...]], ...].
+func redisStreamEntries(reply interface{}, deliveries int64) ([]*RedisStreamMessage, error) {
+	entries, err := redis.Values(reply, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*RedisStreamMessage, 0, len(entries))
+
+	for _, v := range entries {
+		entry, err := redis.Values(v, nil)
+
+		if err != nil || len(entry) != 2 {
+			return nil, fmt.Errorf("yiigo: unexpected stream entry: %v", v)
+		}
+
+		id, err := redis.String(entry[0], nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		msg := &RedisStreamMessage{
+			ID:         id,
+			Deliveries: deliveries,
+		}
+
+		// the deleted entry has nil fields
+		if entry[1] != nil {
+			if msg.Values, err = redis.StringMap(entry[1], nil); err != nil {
+				return nil, err
+			}
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+// nextRedisStreamID returns the smallest ID after id, eg: 1-1 => 1-2.
+func nextRedisStreamID(id string) (string, error) {
+	parts := strings.SplitN(id, "-", 2)
+
+	if len(parts) != 2 {
+		return "", fmt.Errorf("yiigo: invalid stream id: %s", id)
+	}
+
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+
+	if err != nil {
+		return "", err
+	}
+
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+
+	if err != nil {
+		return "", err
+	}
+
+	if seq == ^uint64(0) {
+		return fmt.Sprintf("%d-0", ms+1), nil
+	}
+
+	return fmt.Sprintf("%d-%d", ms, seq+1), nil
+}
+
+func stopRedisStreamWorkers(ctx context.Context, report func(resource string, err error)) {
+	redisStreamMutex.Lock()
+	list := redisStreamWorkers
+	redisStreamWorkers = nil
+	redisStreamMutex.Unlock()
+
+	// stop all first and then wait
+	for _, w := range list {
+		w.once.Do(func() {
+			close(w.stop)
+		})
+	}
+
+	for _, w := range list {
+		if err := w.Stop(ctx); err != nil {
+			report(fmt.Sprintf("redis.%s.stream.%s", w.name, w.consumer.Stream()), err)
+
+			return
+		}
+	}
+
+	if len(list) != 0 {
+		logger.Info("[yiigo] redis stream workers stopped")
+	}
+}
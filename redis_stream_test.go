@@ -0,0 +1,303 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type testStreamConsumer struct {
+	stream   string
+	fail     bool
+	received chan *RedisStreamMessage
+
+	// block blocks the handling until it's closed
+	block chan struct{}
+}
+
+func (c *testStreamConsumer) HandleMessage(msg *RedisStreamMessage) error {
+	c.received <- msg
+
+	if c.block != nil {
+		<-c.block
+	}
+
+	if c.fail {
+		return errors.New("handle failed")
+	}
+
+	return nil
+}
+
+func (c *testStreamConsumer) Stream() string {
+	return c.stream
+}
+
+func (c *testStreamConsumer) Group() string {
+	return "workers"
+}
+
+func (c *testStreamConsumer) MaxDeliveries() int64 {
+	return 2
+}
+
+func TestRedisStreamOption(t *testing.T) {
+	setting := new(redisStreamSetting)
+
+	options := []RedisStreamOption{
+		WithRedisStreamConsumerName("worker-1"),
+		WithRedisStreamBatch(100),
+		WithRedisStreamBlock(time.Second),
+		WithRedisStreamClaim(5*time.Minute, time.Minute),
+		WithRedisStreamDeadLetter("orders:dlq"),
+		WithRedisStreamStartID("0"),
+	}
+
+	for _, f := range options {
+		f(setting)
+	}
+
+	assert.Equal(t, &redisStreamSetting{
+		consumer:      "worker-1",
+		batch:         100,
+		block:         time.Second,
+		claimIdle:     5 * time.Minute,
+		claimInterval: time.Minute,
+		deadLetter:    "orders:dlq",
+		startID:       "0",
+	}, setting)
+}
+
+func TestNextRedisStreamID(t *testing.T) {
+	id, err := nextRedisStreamID("1526919030474-55")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1526919030474-56", id)
+
+	id, err = nextRedisStreamID("1526919030474-18446744073709551615")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1526919030475-0", id)
+
+	_, err = nextRedisStreamID("1526919030474")
+
+	assert.NotNil(t, err)
+}
+
+func TestRedisStreamWorker(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	redisMap.Store("stream", pool)
+	defer redisMap.Delete("stream")
+
+	ctx := context.Background()
+
+	consumer := &testStreamConsumer{
+		stream:   "orders",
+		received: make(chan *RedisStreamMessage, 10),
+	}
+
+	w := NewRedisStreamWorker("stream", consumer, WithRedisStreamBlock(50*time.Millisecond))
+
+	assert.Nil(t, w.Start(ctx))
+
+	// started once
+	assert.NotNil(t, w.Start(ctx))
+
+	// the group already exists
+	assert.Nil(t, w.createGroup(ctx))
+
+	client := NewRedisClient(pool)
+
+	_, err := client.Do(ctx, "XADD", "orders", "*", "order_id", "1001")
+
+	assert.Nil(t, err)
+
+	select {
+	case msg := <-consumer.received:
+		assert.Equal(t, "orders", msg.Stream)
+		assert.Equal(t, map[string]string{"order_id": "1001"}, msg.Values)
+		assert.Equal(t, int64(1), msg.Deliveries)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	// stopped by Shutdown
+	stopRedisStreamWorkers(ctx, func(resource string, err error) {
+		assert.Nil(t, err)
+	})
+
+	select {
+	case <-w.done:
+	case <-time.After(time.Second):
+		t.Fatal("worker not stopped")
+	}
+
+	// acknowledged
+	pending, err := w.pending("-")
+
+	assert.Nil(t, err)
+	assert.Len(t, pending, 0)
+}
+
+func TestRedisStreamWorkerNotStarted(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	redisMap.Store("stream", pool)
+	defer redisMap.Delete("stream")
+
+	consumer := &testStreamConsumer{
+		stream:   "orders",
+		received: make(chan *RedisStreamMessage, 10),
+	}
+
+	w := NewRedisStreamWorker("stream", consumer)
+
+	// returns immediately without waiting for ctx
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	defer cancel()
+
+	assert.Nil(t, w.Stop(ctx))
+
+	// the stopped worker can't be started
+	assert.NotNil(t, w.Start(ctx))
+	assert.Nil(t, w.Stop(ctx))
+}
+
+func TestRedisStreamDeadLetter(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	redisMap.Store("stream", pool)
+	defer redisMap.Delete("stream")
+
+	ctx := context.Background()
+
+	consumer := &testStreamConsumer{
+		stream:   "payments",
+		fail:     true,
+		received: make(chan *RedisStreamMessage, 10),
+	}
+
+	w := NewRedisStreamWorker("stream", consumer,
+		WithRedisStreamBlock(50*time.Millisecond),
+		WithRedisStreamClaim(20*time.Millisecond, 30*time.Millisecond),
+	)
+
+	assert.Nil(t, w.Start(ctx))
+
+	client := NewRedisClient(pool)
+
+	id, err := redis.String(client.Do(ctx, "XADD", "payments", "*", "payment_id", "2001"))
+
+	assert.Nil(t, err)
+
+	// delivered by XREADGROUP and redelivered by XCLAIM
+	for i := int64(1); i <= 2; i++ {
+		select {
+		case msg := <-consumer.received:
+			assert.Equal(t, id, msg.ID)
+			assert.Equal(t, i, msg.Deliveries)
+		case <-time.After(time.Second):
+			t.Fatal("message not received")
+		}
+	}
+
+	// moved to the dead-letter stream after max deliveries
+	deadline := time.Now().Add(time.Second)
+
+	var dead []*RedisStreamMessage
+
+	for time.Now().Before(deadline) {
+		reply, err := client.Do(ctx, "XRANGE", "payments:dead", "-", "+")
+
+		assert.Nil(t, err)
+
+		if dead, err = redisStreamEntries(reply, 0); err == nil && len(dead) != 0 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Nil(t, w.Stop(ctx))
+
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, map[string]string{
+			"payment_id":  "2001",
+			"_stream":     "payments",
+			"_group":      "workers",
+			"_id":         id,
+			"_deliveries": "2",
+		}, dead[0].Values)
+	}
+
+	pending, err := w.pending("-")
+
+	assert.Nil(t, err)
+	assert.Len(t, pending, 0)
+
+	assert.Len(t, consumer.received, 0)
+}
+
+func TestRedisStreamInflight(t *testing.T) {
+	_, pool := newTestRedis(t)
+
+	redisMap.Store("stream", pool)
+	defer redisMap.Delete("stream")
+
+	ctx := context.Background()
+
+	consumer := &testStreamConsumer{
+		stream:   "refunds",
+		received: make(chan *RedisStreamMessage, 10),
+		block:    make(chan struct{}),
+	}
+
+	w := NewRedisStreamWorker("stream", consumer,
+		WithRedisStreamBlock(50*time.Millisecond),
+		WithRedisStreamClaim(20*time.Millisecond, 30*time.Millisecond),
+	)
+
+	assert.Nil(t, w.Start(ctx))
+
+	client := NewRedisClient(pool)
+
+	id, err := redis.String(client.Do(ctx, "XADD", "refunds", "*", "refund_id", "3001"))
+
+	assert.Nil(t, err)
+
+	select {
+	case msg := <-consumer.received:
+		assert.Equal(t, id, msg.ID)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	// the message is idle for several claim intervals while it's being handled
+	time.Sleep(200 * time.Millisecond)
+
+	pending, err := w.pending("-")
+
+	assert.Nil(t, err)
+
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, int64(1), pending[0].deliveries)
+	}
+
+	close(consumer.block)
+
+	assert.Nil(t, w.Stop(ctx))
+
+	// not claimed by the same worker
+	assert.Len(t, consumer.received, 0)
+
+	pending, err = w.pending("-")
+
+	assert.Nil(t, err)
+	assert.Len(t, pending, 0)
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,6 +14,7 @@ func TestRedisOption(t *testing.T) {
 	}
 
 	options := []RedisOption{
+		WithRedisPassword("secret"),
 		WithRedisDatabase(1),
 		WithRedisConnTimeout(10 * time.Second),
 		WithRedisReadTimeout(10 * time.Second),
@@ -30,6 +32,7 @@ func TestRedisOption(t *testing.T) {
 	}
 
 	assert.Equal(t, &redisSetting{
+		password:     "secret",
 		database:     1,
 		connTimeout:  10 * time.Second,
 		readTimeout:  10 * time.Second,
@@ -42,3 +45,20 @@ func TestRedisOption(t *testing.T) {
 		},
 	}, setting)
 }
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, RedisPool) {
+	mr, err := miniredis.Run()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := newRedis(mr.Addr())
+
+	t.Cleanup(func() {
+		pool.(redisCloser).close()
+		mr.Close()
+	})
+
+	return mr, pool
+}
@@ -0,0 +1,191 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+type redisCloser interface {
+	close()
+}
+
+// Shutdown gracefully closes every registered resource in order:
+//
+//  1. stop the nsq consumers and the redis stream workers, wait for the in-flight messages
+//  2. stop the nsq producer
+//  3. close the redis pools (including clusters) and dbs, disconnect the mongo clients
+//  4. sync all the loggers
+//
+// It returns the first error and logs the others, when ctx is done the remaining steps are skipped and ctx.Err() is returned,
+// except that the loggers are always synced, so that the buffered logs aren't lost on a timeout.
+func Shutdown(ctx context.Context) error {
+	var firstErr error
+
+	report := func(resource string, err error) {
+		if err == nil {
+			return
+		}
+
+		logger.Error("[yiigo] shutdown error", zap.String("resource", resource), zap.Error(err))
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	steps := []func(ctx context.Context, report func(resource string, err error)){
+		stopNSQConsumers,
+		stopRedisStreamWorkers,
+		stopNSQProducer,
+		closeConnections,
+	}
+
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			break
+		}
+
+		step(ctx, report)
+	}
+
+	syncLoggers(report)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return firstErr
+}
+
+func stopNSQConsumers(ctx context.Context, report func(resource string, err error)) {
+	nsqMutex.Lock()
+	list := consumers
+	consumers = nil
+	nsqMutex.Unlock()
+
+	// Stop is async, stop all first and then wait
+	for _, c := range list {
+		c.Stop()
+	}
+
+	for _, c := range list {
+		select {
+		case <-c.StopChan:
+		case <-ctx.Done():
+			report("nsq.consumer", ctx.Err())
+
+			return
+		}
+	}
+
+	if len(list) != 0 {
+		logger.Info("[yiigo] nsq consumers stopped")
+	}
+}
+
+func stopNSQProducer(ctx context.Context, report func(resource string, err error)) {
+	nsqMutex.Lock()
+	p := producer
+	producer = nil
+	nsqMutex.Unlock()
+
+	if p == nil {
+		return
+	}
+
+	waitDone(ctx, "nsq.producer", report, func() error {
+		p.Stop()
+
+		return nil
+	})
+
+	logger.Info("[yiigo] nsq producer stopped")
+}
+
+func closeConnections(ctx context.Context, report func(resource string, err error)) {
+	redisMap.Range(func(key, value interface{}) bool {
+		if v, ok := value.(redisCloser); ok {
+			waitDone(ctx, fmt.Sprintf("redis.%v", key), report, func() error {
+				v.close()
+
+				return nil
+			})
+		}
+
+		return ctx.Err() == nil
+	})
+
+	redisClusterMap.Range(func(key, value interface{}) bool {
+		waitDone(ctx, fmt.Sprintf("redis.%v", key), report, func() error {
+			value.(*RedisClusterClient).close()
+
+			return nil
+		})
+
+		return ctx.Err() == nil
+	})
+
+	dbMap.Range(func(key, value interface{}) bool {
+		waitDone(ctx, fmt.Sprintf("db.%v", key), report, value.(*RWDB).Close)
+
+		return ctx.Err() == nil
+	})
+
+	mgoMap.Range(func(key, value interface{}) bool {
+		report(fmt.Sprintf("mongodb.%v", key), value.(*mongo.Client).Disconnect(ctx))
+
+		return ctx.Err() == nil
+	})
+}
+
+func syncLoggers(report func(resource string, err error)) {
+	logMap.Range(func(key, value interface{}) bool {
+		report(fmt.Sprintf("logger.%v", key), loggerSyncError(value.(*zap.Logger).Sync()))
+
+		return true
+	})
+}
+
+// loggerSyncError ignores the EINVAL and ENOTTY errors of syncing stdout and stderr,
+// which are returned when they are terminals or pipes (see uber-go/zap#370).
+func loggerSyncError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{err}
+
+	// the errors of the tee cores are combined by multierr
+	if group, ok := err.(interface{ Errors() []error }); ok {
+		errs = group.Errors()
+	}
+
+	for _, e := range errs {
+		if !errors.Is(e, syscall.EINVAL) && !errors.Is(e, syscall.ENOTTY) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitDone runs fn and waits for it to be done or ctx to be done.
+func waitDone(ctx context.Context, resource string, report func(resource string, err error), fn func() error) {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		report(resource, err)
+	case <-ctx.Done():
+		report(resource, ctx.Err())
+	}
+}
@@ -0,0 +1,148 @@
+package yiigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// isolateResources moves the registered resources aside until the test ends,
+// so that `Shutdown` only closes the ones created by the test.
+func isolateResources(t *testing.T) {
+	maps := []*sync.Map{&redisMap, &redisClusterMap, &dbMap, &entMap, &mgoMap, &logMap}
+
+	saved := make([]map[interface{}]interface{}, len(maps))
+
+	for i, m := range maps {
+		saved[i] = make(map[interface{}]interface{})
+
+		m.Range(func(key, value interface{}) bool {
+			saved[i][key] = value
+
+			m.Delete(key)
+
+			return true
+		})
+	}
+
+	nsqMutex.Lock()
+	savedProducer, savedConsumers := producer, consumers
+	producer, consumers = nil, nil
+	nsqMutex.Unlock()
+
+	redisStreamMutex.Lock()
+	savedWorkers := redisStreamWorkers
+	redisStreamWorkers = nil
+	redisStreamMutex.Unlock()
+
+	t.Cleanup(func() {
+		for i, m := range maps {
+			for key, value := range saved[i] {
+				m.Store(key, value)
+			}
+		}
+
+		nsqMutex.Lock()
+		producer, consumers = savedProducer, savedConsumers
+		nsqMutex.Unlock()
+
+		redisStreamMutex.Lock()
+		redisStreamWorkers = savedWorkers
+		redisStreamMutex.Unlock()
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	isolateResources(t)
+
+	Init(WithDB("shutdown", SQLite, "file:yiigo_shutdown?mode=memory&cache=shared"))
+
+	db := DB("shutdown")
+
+	assert.Nil(t, db.Ping())
+
+	_, pool := newTestRedis(t)
+
+	redisMap.Store("shutdown", pool)
+
+	// stderr can't be synced when it's a terminal or pipe
+	logMap.Store("shutdown", debugLogger())
+	logMap.Store("shutdown_stderr", newLogger(filepath.Join(t.TempDir(), "shutdown.log"), &loggerSetting{stderr: true}))
+
+	// the remaining steps are skipped when ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	assert.Equal(t, context.Canceled, Shutdown(ctx))
+	assert.Nil(t, db.Ping())
+
+	assert.Nil(t, Shutdown(context.Background()))
+	assert.NotNil(t, db.Ping())
+
+	// the closed pool isn't reopened
+	_, err := pool.Get(context.Background())
+
+	assert.Equal(t, ErrRedisPoolClosed, err)
+}
+
+type countSyncer struct {
+	syncs int32
+}
+
+func (s *countSyncer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (s *countSyncer) Sync() error {
+	atomic.AddInt32(&s.syncs, 1)
+
+	return nil
+}
+
+func TestShutdownSyncLoggers(t *testing.T) {
+	isolateResources(t)
+
+	syncer := new(countSyncer)
+
+	logMap.Store("shutdown_sync", zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), syncer, zap.DebugLevel)))
+
+	// the loggers are synced even if ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	assert.Equal(t, context.Canceled, Shutdown(ctx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&syncer.syncs))
+}
+
+func TestLoggerSyncError(t *testing.T) {
+	assert.Nil(t, loggerSyncError(nil))
+
+	errEINVAL := &os.PathError{Op: "sync", Path: "/dev/stderr", Err: syscall.EINVAL}
+	errENOTTY := &os.PathError{Op: "sync", Path: "/dev/stdout", Err: syscall.ENOTTY}
+
+	assert.Nil(t, loggerSyncError(errEINVAL))
+	assert.Nil(t, loggerSyncError(multierr.Combine(errEINVAL, errENOTTY)))
+
+	errSync := errors.New("disk full")
+
+	assert.Equal(t, errSync, loggerSyncError(errSync))
+
+	err := multierr.Combine(errEINVAL, errSync)
+
+	assert.Equal(t, err, loggerSyncError(err))
+
+	assert.Nil(t, loggerSyncError(fmt.Errorf("sync: %w", errENOTTY)))
+}
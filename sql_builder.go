@@ -0,0 +1,815 @@
+package yiigo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// SQLClause SQL clause
+type SQLClause struct {
+	table   string
+	keyword string
+	query   string
+	binds   []interface{}
+}
+
+// Clause returns sql clause, eg: yiigo.Clause("price * ? + ?", 2, 100).
+func Clause(query string, binds ...interface{}) *SQLClause {
+	return &SQLClause{
+		query: query,
+		binds: binds,
+	}
+}
+
+// SQLBuilder is the interface that wraps the query options.
+type SQLBuilder interface {
+	// Wrap wrapping query options
+	Wrap(options ...QueryOption) SQLWrapper
+}
+
+type queryBuilder struct {
+	driver DBDriver
+}
+
+func (b *queryBuilder) Wrap(options ...QueryOption) SQLWrapper {
+	wrapper := &queryWrapper{
+		builder: b,
+		columns: []string{"*"},
+	}
+
+	for _, f := range options {
+		f(wrapper)
+	}
+
+	return wrapper
+}
+
+func (b *queryBuilder) rebind(query string) string {
+	return sqlx.Rebind(sqlx.BindType(string(b.driver)), query)
+}
+
+// NewSQLBuilder returns new SQLBuilder
+func NewSQLBuilder(driver DBDriver) SQLBuilder {
+	return &queryBuilder{driver: driver}
+}
+
+// NewMySQLBuilder returns new SQLBuilder for MySQL
+func NewMySQLBuilder() SQLBuilder {
+	return NewSQLBuilder(MySQL)
+}
+
+// NewPGSQLBuilder returns new SQLBuilder for Postgres
+func NewPGSQLBuilder() SQLBuilder {
+	return NewSQLBuilder(Postgres)
+}
+
+// NewSQLiteBuilder returns new SQLBuilder for SQLite
+func NewSQLiteBuilder() SQLBuilder {
+	return NewSQLBuilder(SQLite)
+}
+
+// SQLWrapper is the interface that builds the sql statements.
+type SQLWrapper interface {
+	// ToQuery returns query statement and binds.
+	ToQuery() (string, []interface{})
+
+	// ToInsert returns insert statement and binds.
+	// data expects `struct`, `*struct`, `yiigo.X`.
+	ToInsert(data interface{}) (string, []interface{})
+
+	// ToBatchInsert returns batch insert statement and binds.
+	// data expects `[]struct`, `[]*struct` (without nil), `[]yiigo.X` (every row has the same keys).
+	ToBatchInsert(data interface{}) (string, []interface{})
+
+	// ToUpdate returns update statement and binds.
+	// data expects `struct`, `*struct`, `yiigo.X`.
+	ToUpdate(data interface{}) (string, []interface{})
+
+	// ToDelete returns delete statement and binds.
+	ToDelete() (string, []interface{})
+
+	// ToTruncate returns truncate statement
+	ToTruncate() string
+}
+
+type queryWrapper struct {
+	builder  *queryBuilder
+	table    string
+	columns  []string
+	distinct bool
+	joins    []*SQLClause
+	where    *SQLClause
+	groups   []string
+	having   *SQLClause
+	orders   []string
+	offset   int
+	limit    int
+	unions   []*SQLClause
+}
+
+func (w *queryWrapper) ToQuery() (string, []interface{}) {
+	query, binds := w.subquery()
+
+	if len(w.unions) != 0 {
+		var builder strings.Builder
+
+		builder.WriteString("(")
+		builder.WriteString(query)
+		builder.WriteString(")")
+
+		for _, v := range w.unions {
+			builder.WriteString(" ")
+			builder.WriteString(v.keyword)
+			builder.WriteString(" (")
+			builder.WriteString(v.query)
+			builder.WriteString(")")
+
+			binds = append(binds, v.binds...)
+		}
+
+		query = builder.String()
+	}
+
+	query = w.builder.rebind(query)
+
+	return query, binds
+}
+
+func (w *queryWrapper) subquery() (string, []interface{}) {
+	binds := make([]interface{}, 0)
+
+	var builder strings.Builder
+
+	builder.WriteString("SELECT ")
+
+	if w.distinct {
+		builder.WriteString("DISTINCT ")
+	}
+
+	builder.WriteString(strings.Join(w.columns, ", "))
+	builder.WriteString(" FROM ")
+	builder.WriteString(w.table)
+
+	for _, v := range w.joins {
+		builder.WriteString(" ")
+		builder.WriteString(v.keyword)
+		builder.WriteString(" JOIN ")
+		builder.WriteString(v.table)
+
+		if len(v.query) != 0 {
+			builder.WriteString(" ON ")
+			builder.WriteString(v.query)
+		}
+	}
+
+	if w.where != nil {
+		builder.WriteString(" WHERE ")
+		builder.WriteString(w.where.query)
+
+		binds = append(binds, w.where.binds...)
+	}
+
+	if len(w.groups) != 0 {
+		builder.WriteString(" GROUP BY ")
+		builder.WriteString(strings.Join(w.groups, ", "))
+	}
+
+	if w.having != nil {
+		builder.WriteString(" HAVING ")
+		builder.WriteString(w.having.query)
+
+		binds = append(binds, w.having.binds...)
+	}
+
+	if len(w.orders) != 0 {
+		builder.WriteString(" ORDER BY ")
+		builder.WriteString(strings.Join(w.orders, ", "))
+	}
+
+	if w.limit != 0 {
+		builder.WriteString(" LIMIT ?")
+
+		binds = append(binds, w.limit)
+	}
+
+	if w.offset != 0 {
+		builder.WriteString(" OFFSET ?")
+
+		binds = append(binds, w.offset)
+	}
+
+	return builder.String(), binds
+}
+
+func (w *queryWrapper) ToInsert(data interface{}) (string, []interface{}) {
+	var (
+		columns []string
+		binds   []interface{}
+	)
+
+	v := reflect.Indirect(reflect.ValueOf(data))
+
+	switch v.Kind() {
+	case reflect.Map:
+		x, ok := data.(X)
+
+		if !ok {
+			logger.Error("[yiigo] invalid data type for insert, expects: struct, *struct, yiigo.X")
+
+			return "", nil
+		}
+
+		columns, binds = w.insertWithMap(x)
+	case reflect.Struct:
+		columns, binds = w.insertWithStruct(v)
+	default:
+		logger.Error("[yiigo] invalid data type for insert, expects: struct, *struct, yiigo.X")
+
+		return "", nil
+	}
+
+	if len(columns) == 0 {
+		logger.Error("[yiigo] empty columns for insert")
+
+		return "", nil
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString("INSERT INTO ")
+	builder.WriteString(w.table)
+	builder.WriteString(" (")
+	builder.WriteString(strings.Join(columns, ", "))
+	builder.WriteString(") VALUES (?")
+	builder.WriteString(strings.Repeat(", ?", len(columns)-1))
+	builder.WriteString(")")
+
+	query := w.builder.rebind(builder.String())
+
+	return query, binds
+}
+
+func (w *queryWrapper) insertWithMap(data X) (columns []string, binds []interface{}) {
+	columns = sortedKeys(data)
+	binds = make([]interface{}, 0, len(columns))
+
+	for _, k := range columns {
+		binds = append(binds, data[k])
+	}
+
+	return
+}
+
+func (w *queryWrapper) insertWithStruct(v reflect.Value) (columns []string, binds []interface{}) {
+	fields := dbFields(v, true)
+
+	columns = make([]string, 0, len(fields))
+	binds = make([]interface{}, 0, len(fields))
+
+	for _, field := range fields {
+		columns = append(columns, field.column)
+		binds = append(binds, field.value)
+	}
+
+	return
+}
+
+func (w *queryWrapper) ToBatchInsert(data interface{}) (string, []interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+
+	if v.Kind() != reflect.Slice {
+		logger.Error("[yiigo] invalid data type for batch insert, expects: []struct, []*struct, []yiigo.X")
+
+		return "", nil
+	}
+
+	if v.Len() == 0 {
+		logger.Error("[yiigo] empty data for batch insert")
+
+		return "", nil
+	}
+
+	var (
+		columns []string
+		binds   []interface{}
+	)
+
+	e := v.Type().Elem()
+
+	switch {
+	case e == reflect.TypeOf(X{}):
+		if err := checkBatchInsertMaps(v.Interface().([]X)); err != nil {
+			logger.Error("[yiigo] invalid data for batch insert", zap.Error(err))
+
+			return "", nil
+		}
+
+		columns, binds = w.batchInsertWithMap(v.Interface().([]X))
+	case e.Kind() == reflect.Struct || (e.Kind() == reflect.Ptr && e.Elem().Kind() == reflect.Struct):
+		if err := checkBatchInsertStructs(v); err != nil {
+			logger.Error("[yiigo] invalid data for batch insert", zap.Error(err))
+
+			return "", nil
+		}
+
+		columns, binds = w.batchInsertWithStruct(v)
+	default:
+		logger.Error("[yiigo] invalid data type for batch insert, expects: []struct, []*struct, []yiigo.X")
+
+		return "", nil
+	}
+
+	if len(columns) == 0 {
+		logger.Error("[yiigo] empty columns for batch insert")
+
+		return "", nil
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString("INSERT INTO ")
+	builder.WriteString(w.table)
+	builder.WriteString(" (")
+	builder.WriteString(strings.Join(columns, ", "))
+	builder.WriteString(") VALUES ")
+
+	rows := len(binds) / len(columns)
+
+	for i := 0; i < rows; i++ {
+		if i != 0 {
+			builder.WriteString(", ")
+		}
+
+		builder.WriteString("(?")
+		builder.WriteString(strings.Repeat(", ?", len(columns)-1))
+		builder.WriteString(")")
+	}
+
+	query := w.builder.rebind(builder.String())
+
+	return query, binds
+}
+
+// checkBatchInsertMaps checks that every row has the same columns as the first one.
+func checkBatchInsertMaps(data []X) error {
+	for i, x := range data[1:] {
+		if len(x) != len(data[0]) {
+			return fmt.Errorf("row %d has different columns from row 0", i+1)
+		}
+
+		for k := range data[0] {
+			if _, ok := x[k]; !ok {
+				return fmt.Errorf("row %d has different columns from row 0", i+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkBatchInsertStructs checks that there is no nil pointer in the rows.
+func checkBatchInsertStructs(v reflect.Value) error {
+	if v.Type().Elem().Kind() != reflect.Ptr {
+		return nil
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if v.Index(i).IsNil() {
+			return fmt.Errorf("row %d is nil", i)
+		}
+	}
+
+	return nil
+}
+
+func (w *queryWrapper) batchInsertWithMap(data []X) (columns []string, binds []interface{}) {
+	columns = sortedKeys(data[0])
+	binds = make([]interface{}, 0, len(columns)*len(data))
+
+	for _, x := range data {
+		for _, k := range columns {
+			binds = append(binds, x[k])
+		}
+	}
+
+	return
+}
+
+func (w *queryWrapper) batchInsertWithStruct(v reflect.Value) (columns []string, binds []interface{}) {
+	// columns are decided by the first row, so that every row has the same columns
+	fields := dbFields(reflect.Indirect(v.Index(0)), true)
+
+	columns = make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		columns = append(columns, field.column)
+	}
+
+	binds = make([]interface{}, 0, len(columns)*v.Len())
+
+	for i := 0; i < v.Len(); i++ {
+		values := make(map[string]interface{}, len(columns))
+
+		for _, field := range dbFields(reflect.Indirect(v.Index(i)), false) {
+			values[field.column] = field.value
+		}
+
+		for _, column := range columns {
+			binds = append(binds, values[column])
+		}
+	}
+
+	return
+}
+
+func (w *queryWrapper) ToUpdate(data interface{}) (string, []interface{}) {
+	var (
+		columns []string
+		exprs   []string
+		binds   []interface{}
+	)
+
+	v := reflect.Indirect(reflect.ValueOf(data))
+
+	switch v.Kind() {
+	case reflect.Map:
+		x, ok := data.(X)
+
+		if !ok {
+			logger.Error("[yiigo] invalid data type for update, expects: struct, *struct, yiigo.X")
+
+			return "", nil
+		}
+
+		columns, exprs, binds = w.updateWithMap(x)
+	case reflect.Struct:
+		columns, exprs, binds = w.updateWithStruct(v)
+	default:
+		logger.Error("[yiigo] invalid data type for update, expects: struct, *struct, yiigo.X")
+
+		return "", nil
+	}
+
+	if len(columns) == 0 {
+		logger.Error("[yiigo] empty columns for update")
+
+		return "", nil
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString("UPDATE ")
+	builder.WriteString(w.table)
+	builder.WriteString(" SET ")
+
+	for i, column := range columns {
+		if i != 0 {
+			builder.WriteString(", ")
+		}
+
+		builder.WriteString(column)
+		builder.WriteString(" = ")
+		builder.WriteString(exprs[i])
+	}
+
+	if w.where != nil {
+		builder.WriteString(" WHERE ")
+		builder.WriteString(w.where.query)
+
+		binds = append(binds, w.where.binds...)
+	}
+
+	query := w.builder.rebind(builder.String())
+
+	return query, binds
+}
+
+func (w *queryWrapper) updateWithMap(data X) (columns, exprs []string, binds []interface{}) {
+	columns = sortedKeys(data)
+	exprs = make([]string, 0, len(columns))
+	binds = make([]interface{}, 0, len(columns))
+
+	for _, k := range columns {
+		if clause, ok := data[k].(*SQLClause); ok {
+			exprs = append(exprs, clause.query)
+			binds = append(binds, clause.binds...)
+
+			continue
+		}
+
+		exprs = append(exprs, "?")
+		binds = append(binds, data[k])
+	}
+
+	return
+}
+
+func (w *queryWrapper) updateWithStruct(v reflect.Value) (columns, exprs []string, binds []interface{}) {
+	fields := dbFields(v, true)
+
+	columns = make([]string, 0, len(fields))
+	exprs = make([]string, 0, len(fields))
+	binds = make([]interface{}, 0, len(fields))
+
+	for _, field := range fields {
+		columns = append(columns, field.column)
+		exprs = append(exprs, "?")
+		binds = append(binds, field.value)
+	}
+
+	return
+}
+
+func (w *queryWrapper) ToDelete() (string, []interface{}) {
+	binds := make([]interface{}, 0)
+
+	var builder strings.Builder
+
+	builder.WriteString("DELETE FROM ")
+	builder.WriteString(w.table)
+
+	if w.where != nil {
+		builder.WriteString(" WHERE ")
+		builder.WriteString(w.where.query)
+
+		binds = append(binds, w.where.binds...)
+	}
+
+	query := w.builder.rebind(builder.String())
+
+	return query, binds
+}
+
+func (w *queryWrapper) ToTruncate() string {
+	return fmt.Sprintf("TRUNCATE %s", w.table)
+}
+
+// QueryOption configures how we set up the SQL query statement
+type QueryOption func(w *queryWrapper)
+
+// Table specifies the query table.
+func Table(name string) QueryOption {
+	return func(w *queryWrapper) {
+		w.table = name
+	}
+}
+
+// Select specifies the query columns.
+func Select(columns ...string) QueryOption {
+	return func(w *queryWrapper) {
+		w.columns = columns
+	}
+}
+
+// Distinct specifies the `distinct` clause.
+func Distinct(columns ...string) QueryOption {
+	return func(w *queryWrapper) {
+		w.columns = columns
+		w.distinct = true
+	}
+}
+
+// Join specifies the `inner join` clause.
+func Join(table, on string) QueryOption {
+	return func(w *queryWrapper) {
+		w.joins = append(w.joins, &SQLClause{
+			table:   table,
+			keyword: "INNER",
+			query:   on,
+		})
+	}
+}
+
+// LeftJoin specifies the `left join` clause.
+func LeftJoin(table, on string) QueryOption {
+	return func(w *queryWrapper) {
+		w.joins = append(w.joins, &SQLClause{
+			table:   table,
+			keyword: "LEFT",
+			query:   on,
+		})
+	}
+}
+
+// RightJoin specifies the `right join` clause.
+func RightJoin(table, on string) QueryOption {
+	return func(w *queryWrapper) {
+		w.joins = append(w.joins, &SQLClause{
+			table:   table,
+			keyword: "RIGHT",
+			query:   on,
+		})
+	}
+}
+
+// FullJoin specifies the `full join` clause.
+func FullJoin(table, on string) QueryOption {
+	return func(w *queryWrapper) {
+		w.joins = append(w.joins, &SQLClause{
+			table:   table,
+			keyword: "FULL",
+			query:   on,
+		})
+	}
+}
+
+// CrossJoin specifies the `cross join` clause.
+func CrossJoin(table string) QueryOption {
+	return func(w *queryWrapper) {
+		w.joins = append(w.joins, &SQLClause{
+			table:   table,
+			keyword: "CROSS",
+		})
+	}
+}
+
+// Where specifies the `where` clause.
+func Where(query string, binds ...interface{}) QueryOption {
+	return func(w *queryWrapper) {
+		w.where = &SQLClause{
+			query: query,
+			binds: binds,
+		}
+	}
+}
+
+// WhereIn specifies the `where in` clause, the slice binds will be expanded.
+// eg: yiigo.WhereIn("age IN (?)", []int{20, 30}) => age IN (?, ?)
+// If the binds can't be expanded (eg: an empty slice), the clause is always false, so that no rows are matched.
+func WhereIn(query string, binds ...interface{}) QueryOption {
+	return func(w *queryWrapper) {
+		query, binds, err := sqlx.In(query, binds...)
+
+		if err != nil {
+			logger.Error("[yiigo] err where in", zap.Error(err))
+
+			w.where = &SQLClause{query: "1 = 0"}
+
+			return
+		}
+
+		w.where = &SQLClause{
+			query: query,
+			binds: binds,
+		}
+	}
+}
+
+// GroupBy specifies the `group by` clause.
+func GroupBy(columns ...string) QueryOption {
+	return func(w *queryWrapper) {
+		w.groups = columns
+	}
+}
+
+// Having specifies the `having` clause.
+func Having(query string, binds ...interface{}) QueryOption {
+	return func(w *queryWrapper) {
+		w.having = &SQLClause{
+			query: query,
+			binds: binds,
+		}
+	}
+}
+
+// OrderBy specifies the `order by` clause.
+func OrderBy(columns ...string) QueryOption {
+	return func(w *queryWrapper) {
+		w.orders = columns
+	}
+}
+
+// Offset specifies the `offset` clause.
+func Offset(n int) QueryOption {
+	return func(w *queryWrapper) {
+		w.offset = n
+	}
+}
+
+// Limit specifies the `limit` clause.
+func Limit(n int) QueryOption {
+	return func(w *queryWrapper) {
+		w.limit = n
+	}
+}
+
+// Union specifies the `union` clause.
+func Union(wrappers ...SQLWrapper) QueryOption {
+	return func(w *queryWrapper) {
+		for _, wrapper := range wrappers {
+			v, ok := wrapper.(*queryWrapper)
+
+			if !ok {
+				continue
+			}
+
+			query, binds := v.subquery()
+
+			w.unions = append(w.unions, &SQLClause{
+				keyword: "UNION",
+				query:   query,
+				binds:   binds,
+			})
+		}
+	}
+}
+
+// UnionAll specifies the `union all` clause.
+func UnionAll(wrappers ...SQLWrapper) QueryOption {
+	return func(w *queryWrapper) {
+		for _, wrapper := range wrappers {
+			v, ok := wrapper.(*queryWrapper)
+
+			if !ok {
+				continue
+			}
+
+			query, binds := v.subquery()
+
+			w.unions = append(w.unions, &SQLClause{
+				keyword: "UNION ALL",
+				query:   query,
+				binds:   binds,
+			})
+		}
+	}
+}
+
+type dbField struct {
+	column string
+	value  interface{}
+}
+
+// dbFields returns the columns and values of a struct according to the `db` tag,
+// the fields tagged with `db:"-"` are ignored, and the zero fields tagged with `omitempty` are ignored when omit is true.
+func dbFields(v reflect.Value, omit bool) []*dbField {
+	t := v.Type()
+
+	fields := make([]*dbField, 0, v.NumField())
+
+	for i := 0; i < v.NumField(); i++ {
+		ft := t.Field(i)
+
+		// unexported field
+		if len(ft.PkgPath) != 0 {
+			continue
+		}
+
+		tag := ft.Tag.Get("db")
+
+		if tag == "-" {
+			continue
+		}
+
+		column := strings.ToLower(ft.Name)
+		omitempty := false
+
+		if len(tag) != 0 {
+			name, opts := parseTag(tag)
+
+			if len(name) != 0 {
+				column = name
+			}
+
+			omitempty = opts == "omitempty"
+		}
+
+		fv := v.Field(i)
+
+		if omit && omitempty && fv.IsZero() {
+			continue
+		}
+
+		fields = append(fields, &dbField{
+			column: column,
+			value:  fv.Interface(),
+		})
+	}
+
+	return fields
+}
+
+func parseTag(tag string) (string, string) {
+	if idx := strings.Index(tag, ","); idx != -1 {
+		return tag[:idx], tag[idx+1:]
+	}
+
+	return tag, ""
+}
+
+func sortedKeys(x X) []string {
+	keys := make([]string, 0, len(x))
+
+	for k := range x {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
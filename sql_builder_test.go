@@ -0,0 +1,310 @@
+package yiigo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToQuery(t *testing.T) {
+	query, binds := builder.Wrap(
+		Table("user"),
+		Where("id = ?", 1),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT * FROM user WHERE id = ?", query)
+	assert.Equal(t, []interface{}{1}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user"),
+		Where("name = ? AND age > ?", "shenghui0779", 20),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT * FROM user WHERE name = ? AND age > ?", query)
+	assert.Equal(t, []interface{}{"shenghui0779", 20}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user"),
+		WhereIn("age IN (?)", []int{20, 30}),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT * FROM user WHERE age IN (?, ?)", query)
+	assert.Equal(t, []interface{}{20, 30}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user"),
+		Select("id", "name", "age"),
+		Where("id = ?", 1),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT id, name, age FROM user WHERE id = ?", query)
+	assert.Equal(t, []interface{}{1}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user"),
+		Distinct("name"),
+		Where("id = ?", 1),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT DISTINCT name FROM user WHERE id = ?", query)
+	assert.Equal(t, []interface{}{1}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user"),
+		LeftJoin("address", "user.id = address.user_id"),
+		Where("user.id = ?", 1),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT * FROM user LEFT JOIN address ON user.id = address.user_id WHERE user.id = ?", query)
+	assert.Equal(t, []interface{}{1}, binds)
+
+	query, binds = builder.Wrap(
+		Table("address"),
+		Select("user_id", "COUNT(*) AS total"),
+		GroupBy("user_id"),
+		Having("user_id = ?", 1),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT user_id, COUNT(*) AS total FROM address GROUP BY user_id HAVING user_id = ?", query)
+	assert.Equal(t, []interface{}{1}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user"),
+		Where("age > ?", 20),
+		OrderBy("age ASC", "id DESC"),
+		Offset(5),
+		Limit(10),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT * FROM user WHERE age > ? ORDER BY age ASC, id DESC LIMIT ? OFFSET ?", query)
+	assert.Equal(t, []interface{}{20, 10, 5}, binds)
+
+	wrap1 := builder.Wrap(
+		Table("user_1"),
+		Where("id = ?", 2),
+	)
+
+	query, binds = builder.Wrap(
+		Table("user_0"),
+		Where("id = ?", 1),
+		Union(wrap1),
+	).ToQuery()
+
+	assert.Equal(t, "(SELECT * FROM user_0 WHERE id = ?) UNION (SELECT * FROM user_1 WHERE id = ?)", query)
+	assert.Equal(t, []interface{}{1, 2}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user_0"),
+		Where("id = ?", 1),
+		UnionAll(wrap1),
+	).ToQuery()
+
+	assert.Equal(t, "(SELECT * FROM user_0 WHERE id = ?) UNION ALL (SELECT * FROM user_1 WHERE id = ?)", query)
+	assert.Equal(t, []interface{}{1, 2}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user_0"),
+		WhereIn("age IN (?)", []int{10, 20}),
+		Limit(5),
+		Union(
+			builder.Wrap(
+				Table("user_1"),
+				WhereIn("age IN (?)", []int{30, 40}),
+				Limit(5),
+			),
+		),
+	).ToQuery()
+
+	assert.Equal(t, "(SELECT * FROM user_0 WHERE age IN (?, ?) LIMIT ?) UNION (SELECT * FROM user_1 WHERE age IN (?, ?) LIMIT ?)", query)
+	assert.Equal(t, []interface{}{10, 20, 5, 30, 40, 5}, binds)
+}
+
+func TestToInsert(t *testing.T) {
+	type User struct {
+		ID    int    `db:"-"`
+		Name  string `db:"name"`
+		Age   int    `db:"age"`
+		Phone string `db:"phone,omitempty"`
+	}
+
+	query, binds := builder.Wrap(Table("user")).ToInsert(&User{
+		Name: "yiigo",
+		Age:  29,
+	})
+
+	assert.Equal(t, "INSERT INTO user (name, age) VALUES (?, ?)", query)
+	assert.Equal(t, []interface{}{"yiigo", 29}, binds)
+
+	query, binds = builder.Wrap(Table("user")).ToInsert(X{
+		"name": "yiigo",
+		"age":  29,
+	})
+
+	assert.Equal(t, "INSERT INTO user (age, name) VALUES (?, ?)", query)
+	assert.Equal(t, []interface{}{29, "yiigo"}, binds)
+
+	query, binds = builder.Wrap(Table("user")).ToInsert(1)
+
+	assert.Equal(t, "", query)
+	assert.Nil(t, binds)
+}
+
+func TestToBatchInsert(t *testing.T) {
+	type User struct {
+		ID    int    `db:"-"`
+		Name  string `db:"name"`
+		Age   int    `db:"age"`
+		Phone string `db:"phone,omitempty"`
+	}
+
+	query, binds := builder.Wrap(Table("user")).ToBatchInsert([]*User{
+		{
+			Name: "shenghui0779",
+			Age:  20,
+		},
+		{
+			Name: "yiigo",
+			Age:  29,
+		},
+	})
+
+	assert.Equal(t, "INSERT INTO user (name, age) VALUES (?, ?), (?, ?)", query)
+	assert.Equal(t, []interface{}{"shenghui0779", 20, "yiigo", 29}, binds)
+
+	query, binds = builder.Wrap(Table("user")).ToBatchInsert([]X{
+		{
+			"name": "shenghui0779",
+			"age":  20,
+		},
+		{
+			"name": "yiigo",
+			"age":  29,
+		},
+	})
+
+	assert.Equal(t, "INSERT INTO user (age, name) VALUES (?, ?), (?, ?)", query)
+	assert.Equal(t, []interface{}{20, "shenghui0779", 29, "yiigo"}, binds)
+
+	// nil row
+	query, binds = builder.Wrap(Table("user")).ToBatchInsert([]*User{{Name: "yiigo", Age: 29}, nil})
+
+	assert.Equal(t, "", query)
+	assert.Nil(t, binds)
+
+	// mismatched columns
+	query, binds = builder.Wrap(Table("user")).ToBatchInsert([]X{
+		{"name": "shenghui0779", "age": 20},
+		{"name": "yiigo", "phone": "13605869999"},
+	})
+
+	assert.Equal(t, "", query)
+	assert.Nil(t, binds)
+
+	query, binds = builder.Wrap(Table("user")).ToBatchInsert([]X{
+		{"name": "shenghui0779", "age": 20},
+		{"name": "yiigo", "age": 29, "phone": "13605869999"},
+	})
+
+	assert.Equal(t, "", query)
+	assert.Nil(t, binds)
+}
+
+func TestToUpdate(t *testing.T) {
+	type User struct {
+		Name  string `db:"name"`
+		Age   int    `db:"age"`
+		Phone string `db:"phone,omitempty"`
+	}
+
+	query, binds := builder.Wrap(
+		Table("user"),
+		Where("id = ?", 1),
+	).ToUpdate(&User{
+		Name: "yiigo",
+		Age:  29,
+	})
+
+	assert.Equal(t, "UPDATE user SET name = ?, age = ? WHERE id = ?", query)
+	assert.Equal(t, []interface{}{"yiigo", 29, 1}, binds)
+
+	query, binds = builder.Wrap(
+		Table("user"),
+		Where("id = ?", 1),
+	).ToUpdate(X{
+		"name": "yiigo",
+		"age":  29,
+	})
+
+	assert.Equal(t, "UPDATE user SET age = ?, name = ? WHERE id = ?", query)
+	assert.Equal(t, []interface{}{29, "yiigo", 1}, binds)
+
+	query, binds = builder.Wrap(
+		Table("product"),
+		Where("id = ?", 1),
+	).ToUpdate(X{
+		"price": Clause("price * ? + ?", 2, 100),
+	})
+
+	assert.Equal(t, "UPDATE product SET price = price * ? + ? WHERE id = ?", query)
+	assert.Equal(t, []interface{}{2, 100, 1}, binds)
+}
+
+func TestToDelete(t *testing.T) {
+	query, binds := builder.Wrap(
+		Table("user"),
+		Where("id = ?", 1),
+	).ToDelete()
+
+	assert.Equal(t, "DELETE FROM user WHERE id = ?", query)
+	assert.Equal(t, []interface{}{1}, binds)
+
+	// an empty slice matches no rows
+	query, binds = builder.Wrap(
+		Table("user"),
+		WhereIn("id IN (?)", []int{}),
+	).ToDelete()
+
+	assert.Equal(t, "DELETE FROM user WHERE 1 = 0", query)
+	assert.Equal(t, []interface{}{}, binds)
+}
+
+func TestToTruncate(t *testing.T) {
+	query := builder.Wrap(Table("user")).ToTruncate()
+
+	assert.Equal(t, "TRUNCATE user", query)
+}
+
+func TestPGSQLBuilder(t *testing.T) {
+	pgBuilder := NewPGSQLBuilder()
+
+	query, binds := pgBuilder.Wrap(
+		Table("user"),
+		WhereIn("name = ? AND age IN (?)", "yiigo", []int{20, 30}),
+		Limit(10),
+	).ToQuery()
+
+	assert.Equal(t, "SELECT * FROM user WHERE name = $1 AND age IN ($2, $3) LIMIT $4", query)
+	assert.Equal(t, []interface{}{"yiigo", 20, 30, 10}, binds)
+
+	query, binds = pgBuilder.Wrap(
+		Table("user_0"),
+		Where("id = ?", 1),
+		Union(pgBuilder.Wrap(
+			Table("user_1"),
+			Where("id = ?", 2),
+		)),
+	).ToQuery()
+
+	assert.Equal(t, "(SELECT * FROM user_0 WHERE id = $1) UNION (SELECT * FROM user_1 WHERE id = $2)", query)
+	assert.Equal(t, []interface{}{1, 2}, binds)
+
+	query, binds = pgBuilder.Wrap(
+		Table("product"),
+		Where("id = ?", 1),
+	).ToUpdate(X{
+		"price": Clause("price * ? + ?", 2, 100),
+	})
+
+	assert.Equal(t, "UPDATE product SET price = price * $1 + $2 WHERE id = $3", query)
+	assert.Equal(t, []interface{}{2, 100, 1}, binds)
+}